@@ -0,0 +1,200 @@
+package unsafely
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"runtime"
+	"sync"
+	"unsafe"
+)
+
+// Represents the state of a channel. Channels are encoded as pointerValue
+// objects referring to a chanValue, so channels that are shared are preserved.
+type chanValue struct {
+	// Cap is the capacity of the channel's buffer.
+	Cap int `json:"cap"`
+
+	// Closed is true if the channel was closed.
+	Closed bool `json:"closed,omitempty"`
+
+	// Buffer contains the buffered elements, in the order they are received.
+	Buffer []json.RawMessage `json:"buffer"`
+}
+
+// Mirrors the start of runtime.hchan, which is the underlying value of a
+// channel. The fields must be kept in sync with the runtime.
+type hchanHeader struct {
+	qcount   uint           // total data in the queue
+	dataqsiz uint           // size of the circular queue
+	buf      unsafe.Pointer // points to an array of dataqsiz elements
+	elemsize uint16
+	closed   uint32
+	timer    unsafe.Pointer
+	elemtype unsafe.Pointer
+	sendx    uint // send index
+	recvx    uint // receive index
+}
+
+// The result of checking that hchanHeader matches the runtime's layout, which
+// is checked before the first channel is encoded.
+var hchanLayoutErr = sync.OnceValue(checkHchanLayout)
+
+// Checks hchanHeader against a channel in a known state, so that changes to
+// runtime.hchan fail loudly rather than reading the wrong memory.
+func checkHchanLayout() error {
+	ch := make(chan int64, 3)
+	ch <- 1
+	ch <- 2
+	ch <- 3
+	<-ch
+	ch <- 4
+	close(ch)
+
+	// The buffer wraps around, so the oldest element is at the receive index.
+	h := (*hchanHeader)(reflect.ValueOf(ch).UnsafePointer())
+	if h.qcount != 3 || h.dataqsiz != 3 || h.elemsize != 8 || h.closed == 0 ||
+		h.sendx != 1 || h.recvx != 1 || h.buf == nil ||
+		*(*int64)(unsafe.Add(h.buf, h.recvx*8)) != 2 {
+		return fmt.Errorf("unsupported channel layout in %s; hchanHeader must be updated", runtime.Version())
+	}
+
+	return nil
+}
+
+// Returns the bidirectional channel type with the same element type, which
+// identifies the channel regardless of its direction or name.
+func chanIdentityType(chanT reflect.Type) reflect.Type {
+	return reflect.ChanOf(reflect.BothDir, chanT.Elem())
+}
+
+// Encodes the channel to a pointerValue object referring to a chanValue.
+//
+// The buffered elements are read from the channel's buffer without receiving
+// them, so the channel is unchanged. The channel is not locked while reading,
+// so it should not be used concurrently.
+func (s *JSONEncoder) encodeToChanValue(inV reflect.Value) (reflect.Value, error) {
+	if inV.Kind() != reflect.Chan {
+		return zeroValue, fmt.Errorf(
+			"encodeToChanValue: expected value to be a channel; received %v", inV.Kind(),
+		)
+	}
+
+	if name, ok := s.config.wellKnown.nameOf(inV); ok {
+		return reflect.ValueOf(pointerValue{wellKnown: name}), nil
+	}
+
+	key := pointerKey{ptr: inV.UnsafePointer(), elemT: chanIdentityType(inV.Type())}
+
+	return s.encodeToReference(key, inV.IsNil(), func() (reflect.Value, error) {
+		if err := hchanLayoutErr(); err != nil {
+			return zeroValue, fmt.Errorf("encodeToChanValue: %w", err)
+		}
+
+		var (
+			h     = (*hchanHeader)(inV.UnsafePointer())
+			elemT = inV.Type().Elem()
+			cv    = chanValue{
+				Cap:    int(h.dataqsiz),
+				Closed: h.closed != 0,
+				Buffer: make([]json.RawMessage, 0, h.qcount),
+			}
+		)
+
+		for i := range h.qcount {
+			index := (h.recvx + i) % h.dataqsiz
+			elemV := reflect.NewAt(elemT, unsafe.Add(h.buf, uintptr(index)*elemT.Size())).Elem()
+
+			s.goPath.pushIndex(int(i))
+			encodedV, err := s.encode(elemV)
+			s.goPath.pop()
+			if err != nil {
+				return zeroValue, fmt.Errorf("encodeToChanValue: %w", err)
+			}
+
+			elem, err := s.jsonMarshalInternal(encodedV.Interface())
+			if err != nil {
+				return zeroValue, fmt.Errorf("encodeToChanValue: %w", err)
+			}
+
+			cv.Buffer = append(cv.Buffer, elem)
+		}
+
+		return reflect.ValueOf(cv), nil
+	})
+}
+
+// Decodes the pointerValue object referring to a chanValue, and writes the
+// channel to outV.
+//
+// The channel is created with the same capacity, filled with the buffered
+// elements, and closed if the encoded channel was closed.
+func (s *JSONDecoder) decodeFromChanValue(pvV, outV reflect.Value) error {
+	pv, ok := pvV.Interface().(pointerValue)
+	if !ok {
+		return fmt.Errorf(
+			"decodeFromChanValue: expected pvV to be a pointerValue; received %T", pvV.Interface(),
+		)
+	}
+
+	if outV.Kind() != reflect.Chan {
+		return fmt.Errorf("decodeFromChanValue: expected outV to be a channel; received %v", outV.Kind())
+	}
+
+	elemT := outV.Type().Elem()
+	encodedElemT, err := encodedTypeFor(s.options, elemT)
+	if err != nil {
+		return fmt.Errorf("decodeFromChanValue: %w", err)
+	}
+
+	err = s.decodeFromReference(pv, outV, func(value json.RawMessage) (reflect.Value, func() error, error) {
+		var cv chanValue
+		if err := json.Unmarshal(value, &cv); err != nil {
+			return zeroValue, nil, err
+		}
+
+		if cv.Cap < 0 || len(cv.Buffer) > cv.Cap {
+			return zeroValue, nil, fmt.Errorf(
+				"invalid channel with %d buffered elements and capacity %d", len(cv.Buffer), cv.Cap,
+			)
+		}
+
+		chanV := reflect.MakeChan(chanIdentityType(outV.Type()), cv.Cap)
+		decode := func() error {
+			// Elements are copied into the channel, so pointers in them can't be set
+			// later.
+			start := len(s.fixupLog)
+
+			for _, elem := range cv.Buffer {
+				encodedPtrV := reflect.New(encodedElemT)
+				if err := json.Unmarshal(elem, encodedPtrV.Interface()); err != nil {
+					return err
+				}
+
+				elemV := reflect.New(elemT).Elem()
+				if err := s.decodeTo(encodedPtrV.Elem(), elemV); err != nil {
+					return err
+				}
+
+				chanV.Send(elemV)
+			}
+
+			if len(s.fixupLog) > start {
+				return fmt.Errorf("buffered channel elements refer to pointers that have not been decoded")
+			}
+
+			if cv.Closed {
+				chanV.Close()
+			}
+
+			return nil
+		}
+
+		return chanV, decode, nil
+	})
+	if err != nil {
+		return fmt.Errorf("decodeFromChanValue: %w", err)
+	}
+
+	return nil
+}
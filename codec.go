@@ -0,0 +1,115 @@
+package unsafely
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// A codec encodes values of a specific type using a custom encoded type,
+// rather than mirroring the type's fields, e.g, for standard library types
+// whose internal state doesn't round-trip.
+type codec struct {
+	// The type used to represent values in encoded structs.
+	encodedT reflect.Type
+
+	// Encodes the value, which is addressable, to a value of encodedT.
+	encode func(s *JSONEncoder, inV reflect.Value) (reflect.Value, error)
+
+	// Decodes the value of encodedT and writes it to outV.
+	decode func(s *JSONDecoder, encodedV, outV reflect.Value) error
+
+	// If set, struct fields of the type are not encoded, e.g, for sync.Pool.
+	skip bool
+
+	// If set, the encoded values don't contain pointers or other references,
+	// e.g, for time.Time; see mayHaveReferences.
+	leaf bool
+}
+
+var (
+	// Map from types to their built-in codecs.
+	builtinCodecs = make(map[reflect.Type]codec)
+
+	// Functions that return codecs for generic types, e.g, atomic.Pointer[T].
+	genericCodecs []func(t reflect.Type) (codec, bool)
+)
+
+// Registers a built-in codec for values of type T, which are encoded as
+// values of type E.
+//
+// The functions receive pointers to the original values, so the values aren't
+// copied, e.g, for locks.
+func registerCodec[T, E any](
+	encode func(s *JSONEncoder, in *T) (E, error),
+	decode func(s *JSONDecoder, encoded E, out *T) error,
+) {
+	builtinCodecs[reflect.TypeFor[T]()] = codec{
+		encodedT: reflect.TypeFor[E](),
+		encode: func(s *JSONEncoder, inV reflect.Value) (reflect.Value, error) {
+			in := (*T)(ensureAddressable(inV).Addr().UnsafePointer())
+
+			encoded, err := encode(s, in)
+			if err != nil {
+				return zeroValue, err
+			}
+
+			return reflect.ValueOf(encoded), nil
+		},
+		decode: func(s *JSONDecoder, encodedV, outV reflect.Value) error {
+			encoded, ok := encodedV.Interface().(E)
+			if !ok {
+				return fmt.Errorf("expected encoded value to be %T; received %T", encoded, encodedV.Interface())
+			}
+
+			return decode(s, encoded, (*T)(outV.Addr().UnsafePointer()))
+		},
+	}
+}
+
+// Registers a built-in codec like registerCodec, for a type whose encoded
+// values don't contain pointers or other references.
+func registerLeafCodec[T, E any](
+	encode func(s *JSONEncoder, in *T) (E, error),
+	decode func(s *JSONDecoder, encoded E, out *T) error,
+) {
+	registerCodec(encode, decode)
+
+	c := builtinCodecs[reflect.TypeFor[T]()]
+	c.leaf = true
+	builtinCodecs[reflect.TypeFor[T]()] = c
+}
+
+// Returns the built-in codec for the type, if any.
+func codecFor(t reflect.Type) (codec, bool) {
+	if c, ok := builtinCodecs[t]; ok {
+		return c, true
+	}
+
+	for _, genericCodec := range genericCodecs {
+		if c, ok := genericCodec(t); ok {
+			return c, true
+		}
+	}
+
+	return codec{}, false
+}
+
+// Encodes the value using the codec and writes it to encodedV.
+func (s *JSONEncoder) encodeWithCodec(c codec, originalV, encodedV reflect.Value) error {
+	outV, err := c.encode(s, originalV)
+	if err != nil {
+		return fmt.Errorf("encodeWithCodec(): %v: %w", originalV.Type(), err)
+	}
+
+	setField(encodedV, outV)
+	return nil
+}
+
+// Decodes the value using the codec and writes it to decodedV.
+func (s *JSONDecoder) decodeWithCodec(c codec, encodedV, decodedV reflect.Value) error {
+	if err := c.decode(s, encodedV, decodedV); err != nil {
+		return fmt.Errorf("decodeWithCodec(): %v: %w", decodedV.Type(), err)
+	}
+
+	return nil
+}
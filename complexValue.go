@@ -5,48 +5,75 @@ import (
 	"reflect"
 )
 
-var complexValueType = reflect.TypeFor[complexValue]()
+var (
+	complexValueType           = reflect.TypeFor[complexValue]()
+	nanPayloadComplexValueType = reflect.TypeFor[nanPayloadComplexValue]()
+)
 
+// The parts may be NaN or infinite; see encodedFloat64.
 type complexValue struct {
-	Real float64 `json:"real"`
-	Imag float64 `json:"imag"`
+	Real encodedFloat64 `json:"real"`
+	Imag encodedFloat64 `json:"imag"`
+}
+
+// Like complexValue, but keeps the payloads of NaN parts; see WithNaNPayloads.
+type nanPayloadComplexValue struct {
+	Real nanPayloadFloat64 `json:"real"`
+	Imag nanPayloadFloat64 `json:"imag"`
+}
+
+// Returns the type used to represent complex numbers.
+func complexValueTypeFor(options encodingOptions) reflect.Type {
+	if options.NaNPayloads {
+		return nanPayloadComplexValueType
+	}
+	return complexValueType
 }
 
-// Returns true if the provided type is a complexValue.
+// Returns true if the provided type is a complexValue or
+// nanPayloadComplexValue.
 func isComplexValueType(t reflect.Type) bool {
-	return t == complexValueType
+	return t == complexValueType || t == nanPayloadComplexValueType
 }
 
-// Encodes the value to a complexValue object.
-func encodeToComplexValue(inputV reflect.Value) (reflect.Value, error) {
+// Encodes the value to a complexValue or nanPayloadComplexValue object,
+// depending on the encodedT.
+func encodeToComplexValue(inputV reflect.Value, encodedT reflect.Type) (reflect.Value, error) {
 	if inputV.Kind() != reflect.Complex128 && inputV.Kind() != reflect.Complex64 {
 		return reflect.Value{}, fmt.Errorf(
 			"encodeToComplexValue: expected value to be a complex number; received %v", inputV.Kind(),
 		)
 	}
-	var (
-		input = inputV.Complex()
-		cv    = complexValue{
-			Real: real(input),
-			Imag: imag(input),
-		}
-	)
-
-	return reflect.ValueOf(cv), nil
+	input := inputV.Complex()
+
+	if encodedT == nanPayloadComplexValueType {
+		return reflect.ValueOf(nanPayloadComplexValue{
+			Real: nanPayloadFloat64(real(input)),
+			Imag: nanPayloadFloat64(imag(input)),
+		}), nil
+	}
+
+	return reflect.ValueOf(complexValue{
+		Real: encodedFloat64(real(input)),
+		Imag: encodedFloat64(imag(input)),
+	}), nil
 }
 
 // Decodes the complexValue object and writes the output value.
 func decodeFromComplexValue(encodedV reflect.Value, outV reflect.Value) error {
-	cv, ok := encodedV.Interface().(complexValue)
-	if !ok {
+	var decoded complex128
+	switch cv := encodedV.Interface().(type) {
+	case complexValue:
+		decoded = complex(float64(cv.Real), float64(cv.Imag))
+	case nanPayloadComplexValue:
+		decoded = complex(float64(cv.Real), float64(cv.Imag))
+	default:
 		return fmt.Errorf(
 			"decodeFromComplexValue: expected encodedV to be a complexValue; received %T",
 			encodedV.Interface(),
 		)
 	}
 
-	decoded := complex(cv.Real, cv.Imag)
-
 	switch outV.Kind() {
 	case reflect.Complex128:
 		setField(outV, reflect.ValueOf(decoded))
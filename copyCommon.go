@@ -3,24 +3,31 @@ package unsafely
 import (
 	"fmt"
 	"reflect"
+	"strings"
 )
 
 // Handles cases that are the same or similar for encoding and decoding.
 //
-// The copyFn is either encodeTo or decodeTo.
-func copyCommon(copyFn func(fromV, toV reflect.Value) error, fromV, toV reflect.Value) error {
+// The copyFn is either encodeTo or decodeTo. The path tracks the Go path of the
+// value being copied, and may be nil.
+func copyCommon(copyFn func(fromV, toV reflect.Value) error, path *goPath, fromV, toV reflect.Value) error {
 	var (
 		fromT    = fromV.Type()
 		toT      = toV.Type()
 		fromKind = fromT.Kind()
 	)
 
-	// No conversion is needed for int, string, etc.
+	// No conversion is needed for int, string, etc, except between named and
+	// unnamed types; see WithoutCustomMarshalers.
 	if isSimplePrimitive(fromKind) {
 		if fromT != toT {
-			return fmt.Errorf(
-				"copyCommon(): primitive values must be the same type; received %v and %v",
-				fromT, toT)
+			if fromKind != toT.Kind() {
+				return fmt.Errorf(
+					"copyCommon(): primitive values must be the same kind; received %v and %v",
+					fromT, toT)
+			}
+
+			fromV = fromV.Convert(toT)
 		}
 
 		setField(toV, fromV)
@@ -30,7 +37,7 @@ func copyCommon(copyFn func(fromV, toV reflect.Value) error, fromV, toV reflect.
 	// Copying a slice or array works the same in both directions, with the
 	// underlying encoding/decoding deferred to the copyFn.
 	if fromKind == reflect.Slice || fromKind == reflect.Array {
-		return copyArrayLike(copyFn, fromV, toV)
+		return copyArrayLike(copyFn, path, fromV, toV)
 	}
 
 	// All other cases must be handled by the caller.
@@ -38,7 +45,7 @@ func copyCommon(copyFn func(fromV, toV reflect.Value) error, fromV, toV reflect.
 }
 
 // Copies an array or slice of values. Encoding/decoding is delegated to the copyFn.
-func copyArrayLike(copyFn func(fromV, toV reflect.Value) error, fromV, toV reflect.Value) error {
+func copyArrayLike(copyFn func(fromV, toV reflect.Value) error, path *goPath, fromV, toV reflect.Value) error {
 	var (
 		fromT    = fromV.Type()
 		toT      = toV.Type()
@@ -67,7 +74,13 @@ func copyArrayLike(copyFn func(fromV, toV reflect.Value) error, fromV, toV refle
 
 	// Copy each element using the encoding/decoding function.
 	for i := 0; i < fromV.Len(); i++ {
-		if err := copyFn(fromV.Index(i), toV.Index(i)); err != nil {
+		err := func() error {
+			path.pushIndex(i)
+			defer path.pop()
+
+			return copyFn(fromV.Index(i), toV.Index(i))
+		}()
+		if err != nil {
 			return err
 		}
 	}
@@ -76,8 +89,13 @@ func copyArrayLike(copyFn func(fromV, toV reflect.Value) error, fromV, toV refle
 }
 
 // Copies a struct, either for encoding or decoding.
+//
+// Unsafe pointer fields with a type hint (see WithUnsafePointers) are copied
+// using the copyHintedFn instead.
 func copyStruct(
 	copyFn func(fromV, toV reflect.Value) error,
+	copyHintedFn func(fromV, toV reflect.Value, hint string) error,
+	path *goPath,
 	fromV, toV reflect.Value,
 	isEncode bool,
 ) error {
@@ -114,17 +132,21 @@ func copyStruct(
 			return fmt.Errorf("copyStruct(): could not find original field name for field %s", encodedFieldT.Name)
 		}
 
-		// Look up the field in the original struct
-		originalFieldV := originalV.FieldByName(originalFieldName)
-		if !originalFieldV.IsValid() {
-			return fmt.Errorf(
-				"copyStruct(): could not find original field %s for field %s",
-				originalFieldName, encodedFieldT.Name)
+		// Look up the field in the original struct. Fields promoted from embedded
+		// structs have a path of field names, e.g, "Inner.Field".
+		originalFieldV := originalV
+		for _, name := range strings.Split(originalFieldName, ".") {
+			originalFieldV = originalFieldV.FieldByName(name)
+			if !originalFieldV.IsValid() {
+				return fmt.Errorf(
+					"copyStruct(): could not find original field %s for field %s",
+					originalFieldName, encodedFieldT.Name)
+			}
+
+			// The original field may be unexported, so we may need to get an exported copy.
+			originalFieldV = getField(originalFieldV)
 		}
 
-		// The original field may be unexported, so we may need to get an exported copy.
-		originalFieldV = getField(originalFieldV)
-
 		var fromFieldV, toFieldV reflect.Value
 		if isEncode {
 			fromFieldV, toFieldV = originalFieldV, encodedFieldV
@@ -132,7 +154,16 @@ func copyStruct(
 			fromFieldV, toFieldV = encodedFieldV, originalFieldV
 		}
 
-		if err := copyFn(fromFieldV, toFieldV); err != nil {
+		err := func() error {
+			path.push("." + originalFieldName)
+			defer path.pop()
+
+			if hint := encodedFieldT.Tag.Get("elem"); hint != "" {
+				return copyHintedFn(fromFieldV, toFieldV, hint)
+			}
+			return copyFn(fromFieldV, toFieldV)
+		}()
+		if err != nil {
 			return fmt.Errorf("copyStruct(): %w", err)
 		}
 	}
@@ -4,51 +4,72 @@ import (
 	"encoding/json"
 	"fmt"
 	"reflect"
+	"slices"
 	"strconv"
 	"strings"
 )
 
 var (
-	jsonMarshalerType  = reflect.TypeFor[json.Marshaler]()
 	jsonRawMessageType = reflect.TypeFor[json.RawMessage]()
 
 	stringType = reflect.TypeFor[string]()
 
 	// Map from decoded types to encoded types.
-	typeCache = make(map[reflect.Type]reflect.Type)
+	typeCache = make(map[typeCacheKey]reflect.Type)
 )
 
+// The encoded type depends on the encoding options.
+type typeCacheKey struct {
+	options encodingOptions
+	inputT  reflect.Type
+}
+
 // Returns an encoded type for the input type, possibly from the cache.
-func encodedTypeFor(inputT reflect.Type) (reflect.Type, error) {
-	if encodedT, ok := typeCache[inputT]; ok {
+func encodedTypeFor(options encodingOptions, inputT reflect.Type) (reflect.Type, error) {
+	key := typeCacheKey{options: options, inputT: inputT}
+	if encodedT, ok := typeCache[key]; ok {
 		return encodedT, nil
 	}
 
-	encodedT, err := createEncodedTypeFor(inputT)
+	encodedT, err := createEncodedTypeFor(options, inputT)
 	if err != nil {
 		return nil, err
 	}
 
-	typeCache[inputT] = encodedT
+	typeCache[key] = encodedT
 	return encodedT, nil
 }
 
 // Dynamically constructs an encoded type with exported fields that mirrors the
 // input type.
-func createEncodedTypeFor(inputT reflect.Type) (reflect.Type, error) {
-	// If the input type is a json.Marshaler, we store the raw JSON output of the
-	// existing marshaling behavior.
-	if inputT.Implements(jsonMarshalerType) {
-		return jsonRawMessageType, nil
+func createEncodedTypeFor(options encodingOptions, inputT reflect.Type) (reflect.Type, error) {
+	// Some types have built-in codecs, e.g, time.Time.
+	if c, ok := codecFor(inputT); ok {
+		return c.encodedT, nil
+	}
+
+	// If the input type has a marshaler, e.g, json.Marshaler, we store the
+	// output of the existing marshaling behavior. With placeholders, the output
+	// may be replaced by a placeholder if the marshaler fails.
+	if kind := marshalerKindFor(options, inputT); kind != noMarshaler {
+		if options.Placeholders {
+			return marshaledValueType, nil
+		}
+		return marshaledTypeFor(kind), nil
 	}
 
 	var kind = inputT.Kind()
 
-	// Currently unsupported types.
-	if kind == reflect.Chan ||
-		kind == reflect.Func ||
-		kind == reflect.UnsafePointer {
-		return nil, fmt.Errorf("createEncodedTypeFor: unsupported kind %v for %v", inputT.Kind(), inputT)
+	// Unsafe pointers are only supported as references to other pointers.
+	if kind == reflect.UnsafePointer {
+		if !options.UnsafePointers {
+			if options.Placeholders {
+				return placeholderValueType, nil
+			}
+			return nil, fmt.Errorf("createEncodedTypeFor: unsupported kind %v for %v", inputT.Kind(), inputT)
+		}
+
+		return unsafePointerValueType, nil
 	}
 
 	// Interfaces are represented using a struct to track the underlying type.
@@ -62,9 +83,34 @@ func createEncodedTypeFor(inputT reflect.Type) (reflect.Type, error) {
 		return pointerValueType, nil
 	}
 
+	// Functions are represented by their symbol names.
+	if kind == reflect.Func {
+		return funcValueType, nil
+	}
+
+	// Channels are represented like pointers to their state; see chanValue.
+	if kind == reflect.Chan {
+		if _, err := encodedTypeFor(options, inputT.Elem()); err != nil {
+			return nil, fmt.Errorf("createEncodedTypeFor: %w", err)
+		}
+
+		return pointerValueType, nil
+	}
+
+	// With slice aliasing, slices are represented using a struct that refers to
+	// the backing array.
+	if kind == reflect.Slice && options.SliceAliasing {
+		return sliceValueType, nil
+	}
+
+	// With readable output, byte slices and arrays are encoded as text or hex.
+	if isReadableBytes(options, inputT) {
+		return readableBytesType, nil
+	}
+
 	// Resolve the element type for slices and arrays.
 	if kind == reflect.Slice {
-		elemType, err := encodedTypeFor(inputT.Elem())
+		elemType, err := encodedTypeFor(options, inputT.Elem())
 		if err != nil {
 			return nil, fmt.Errorf("createEncodedTypeFor: %w", err)
 		}
@@ -73,7 +119,7 @@ func createEncodedTypeFor(inputT reflect.Type) (reflect.Type, error) {
 	}
 
 	if kind == reflect.Array {
-		elemType, err := encodedTypeFor(inputT.Elem())
+		elemType, err := encodedTypeFor(options, inputT.Elem())
 		if err != nil {
 			return nil, fmt.Errorf("createEncodedTypeFor: %w", err)
 		}
@@ -83,18 +129,20 @@ func createEncodedTypeFor(inputT reflect.Type) (reflect.Type, error) {
 
 	// Resolve the key and value element types for maps.
 	if kind == reflect.Map {
-		keyType, err := encodedTypeFor(inputT.Key())
+		keyType, err := encodedTypeFor(options, inputT.Key())
 		if err != nil {
 			return nil, fmt.Errorf("createEncodedTypeFor: %w", err)
 		}
 
-		valueType, err := encodedTypeFor(inputT.Elem())
+		valueType, err := encodedTypeFor(options, inputT.Elem())
 		if err != nil {
 			return nil, fmt.Errorf("createEncodedTypeFor: %w", err)
 		}
 
-		// JSON maps cannot have struct keys, so we use string keys instead.
-		if !isSimplePrimitive(keyType.Kind()) {
+		// JSON maps cannot have struct keys, so we use string keys instead. Keys
+		// with text marshalers are stored as their text. encoding/json doesn't
+		// support float keys, so these are also stored as JSON strings.
+		if !isSimplePrimitive(keyType.Kind()) || isFloat(keyType.Kind()) || isTextMapKey(options, inputT.Key()) {
 			keyType = stringType
 		}
 
@@ -103,11 +151,30 @@ func createEncodedTypeFor(inputT reflect.Type) (reflect.Type, error) {
 
 	// Complex value types are encoded using complexValue.
 	if isComplexNumber(kind) {
-		return complexValueType, nil
+		return complexValueTypeFor(options), nil
+	}
+
+	// Floats may be NaN, infinite or negative zero; see encodedFloat64.
+	if isFloat(kind) {
+		return encodedFloatType(options, kind), nil
+	}
+
+	// Strings may contain invalid UTF-8; see encodedString. With readable
+	// output, strings with multiple lines are encoded as arrays of lines.
+	if kind == reflect.String {
+		if options.Readable {
+			return readableStringType, nil
+		}
+		return encodedStringType, nil
 	}
 
-	// Simple primitive types are returned as-is.
+	// Simple primitive types are returned as-is. If the marshalers of the type
+	// are ignored, we use the unnamed type instead, so encoding/json doesn't use
+	// them.
 	if isSimplePrimitive(kind) {
+		if options.ignoresMarshalers(inputT) {
+			return unnamedPrimitiveType(kind), nil
+		}
 		return inputT, nil
 	}
 
@@ -125,14 +192,80 @@ func createEncodedTypeFor(inputT reflect.Type) (reflect.Type, error) {
 	// 1. The unsafely.json tag if present
 	// 2. The json tag if present
 	// 3. The original field name if no tags are present
+	//
+	// The original tag contains the path of Go field names to the field, which
+	// has multiple elements for fields promoted from embedded structs, e.g,
+	// "Inner.Field".
+	candidates, err := collectStructFields(options, inputT, nil, 0)
+	if err != nil {
+		return nil, fmt.Errorf("createEncodedTypeFor: %w", err)
+	}
+
+	candidates = dominantStructFields(candidates)
+
+	fields := make([]reflect.StructField, 0, len(candidates))
+	for i, candidate := range candidates {
+		newType, err := encodedTypeFor(options, candidate.field.Type)
+		if err != nil {
+			return nil, fmt.Errorf("createEncodedTypeFor: %w", err)
+		}
+
+		tag := fmt.Sprintf(`json:"%s" original:"%s"`, candidate.jsonTag, strings.Join(candidate.path, "."))
+
+		// Unsafe pointers with a type hint are encoded like pointers to that type.
+		if hint := candidate.field.Tag.Get("unsafely.elem"); hint != "" && newType == unsafePointerValueType {
+			newType = pointerValueType
+			tag += fmt.Sprintf(` elem:"%s"`, hint)
+		}
+
+		field := candidate.field
+		field.Type = newType
+		field.Name = "F" + strconv.Itoa(i)
+		field.PkgPath = "" // mark as exported
+		field.Anonymous = false
+		field.Index = nil
+		field.Offset = 0
+		field.Tag = reflect.StructTag(tag)
+
+		fields = append(fields, field)
+	}
+
+	return reflect.StructOf(fields), nil
+}
+
+// A field that may be included in an encoded struct.
+type structFieldCandidate struct {
+	field reflect.StructField
+
+	// The path of Go field names from the outermost struct to the field.
+	path []string
+
+	// The JSON name of the field, and the full JSON tag.
+	jsonName, jsonTag string
+
+	// Whether the JSON name was set by a tag.
+	tagged bool
+
+	// The number of embedded structs containing the field.
+	depth int
+}
+
+// Returns the fields of the struct type in order, including fields promoted
+// from embedded structs if the options flatten embedded fields.
+func collectStructFields(
+	options encodingOptions,
+	structT reflect.Type,
+	parentPath []string,
+	depth int,
+) ([]structFieldCandidate, error) {
 	var (
-		fields        = make([]reflect.StructField, 0, inputT.NumField())
+		candidates    []structFieldCandidate
 		usedJsonNames = make(map[string]string) // maps json name to field name
 	)
 
-	for i := 0; i < inputT.NumField(); i++ {
+	for i := 0; i < structT.NumField(); i++ {
 		var (
-			field     = inputT.Field(i)
+			field     = structT.Field(i)
 			fieldName = field.Name
 			jsonTag   string
 		)
@@ -148,12 +281,18 @@ func createEncodedTypeFor(inputT reflect.Type) (reflect.Type, error) {
 			continue
 		}
 
+		// Some types aren't encoded in structs, e.g, sync.Pool.
+		if c, ok := codecFor(field.Type); ok && c.skip {
+			continue
+		}
+
 		// Extract the JSON field name from the tag, e.g, json:"key,omitempty"
 		//
 		// If the JSON field name is empty, we rewrite the tag to add the struct
 		// field name; otherwise, we overwrite the JSON name with that
 		jsonName, jsonOptions, hasOptions := strings.Cut(jsonTag, ",")
-		if jsonName == "" {
+		tagged := jsonName != ""
+		if !tagged {
 			jsonName = fieldName
 		}
 
@@ -163,6 +302,24 @@ func createEncodedTypeFor(inputT reflect.Type) (reflect.Type, error) {
 			jsonTag = jsonName
 		}
 
+		path := append(slices.Clip(parentPath), fieldName)
+
+		// Promote the fields of untagged embedded structs, like encoding/json.
+		flatten, err := shouldFlattenField(options, field, tagged)
+		if err != nil {
+			return nil, fmt.Errorf("collectStructFields: %w", err)
+		}
+
+		if flatten {
+			promoted, err := collectStructFields(options, field.Type, path, depth+1)
+			if err != nil {
+				return nil, err
+			}
+
+			candidates = append(candidates, promoted...)
+			continue
+		}
+
 		// Check for duplicate JSON field names.
 		if existingField, exists := usedJsonNames[jsonName]; exists {
 			return nil, fmt.Errorf("createEncodedTypeFor(): duplicate JSON field name %q (struct fields %q and %q)",
@@ -170,18 +327,90 @@ func createEncodedTypeFor(inputT reflect.Type) (reflect.Type, error) {
 		}
 		usedJsonNames[jsonName] = field.Name
 
-		newType, err := encodedTypeFor(field.Type)
-		if err != nil {
-			return nil, fmt.Errorf("createEncodedTypeFor: %w", err)
+		candidates = append(candidates, structFieldCandidate{
+			field:    field,
+			path:     path,
+			jsonName: jsonName,
+			jsonTag:  jsonTag,
+			tagged:   tagged,
+			depth:    depth,
+		})
+	}
+
+	return candidates, nil
+}
+
+// Returns true if the fields of the embedded struct field should be promoted
+// to the containing struct.
+//
+// Embedded pointers are not flattened, so nil pointers and shared pointers are
+// preserved. Embedded structs with custom encodings are also not flattened.
+func shouldFlattenField(options encodingOptions, field reflect.StructField, tagged bool) (bool, error) {
+	if !options.FlattenEmbedded || !field.Anonymous || tagged || field.Type.Kind() != reflect.Struct {
+		return false, nil
+	}
+
+	if _, ok := codecFor(field.Type); ok {
+		return false, nil
+	}
+
+	encodedT, err := encodedTypeFor(options, field.Type)
+	if err != nil {
+		return false, err
+	}
+
+	return encodedT.Kind() == reflect.Struct, nil
+}
+
+// Resolves conflicts between fields with the same JSON name using the rules
+// of encoding/json: the shallowest field wins, then the only tagged field at
+// that depth. If there is no single dominant field, the fields are dropped.
+//
+// Duplicate names in the same struct are reported by collectStructFields.
+func dominantStructFields(candidates []structFieldCandidate) []structFieldCandidate {
+	byName := make(map[string][]structFieldCandidate)
+	for _, candidate := range candidates {
+		byName[candidate.jsonName] = append(byName[candidate.jsonName], candidate)
+	}
+
+	dominant := make([]structFieldCandidate, 0, len(candidates))
+	for _, candidate := range candidates {
+		conflicts := byName[candidate.jsonName]
+		if len(conflicts) == 1 {
+			dominant = append(dominant, candidate)
+			continue
 		}
 
-		field.Type = newType
-		field.Name = "F" + strconv.Itoa(i)
-		field.PkgPath = "" // mark as exported
-		field.Tag = reflect.StructTag(fmt.Sprintf(`json:"%s" original:"%s"`, jsonTag, fieldName))
+		var (
+			minDepth = slices.MinFunc(conflicts, func(a, b structFieldCandidate) int {
+				return a.depth - b.depth
+			}).depth
+			shallowest, tagged []structFieldCandidate
+		)
 
-		fields = append(fields, field)
+		for _, conflict := range conflicts {
+			if conflict.depth != minDepth {
+				continue
+			}
+
+			shallowest = append(shallowest, conflict)
+			if conflict.tagged {
+				tagged = append(tagged, conflict)
+			}
+		}
+
+		var winner []structFieldCandidate
+		switch {
+		case len(shallowest) == 1:
+			winner = shallowest
+		case len(tagged) == 1:
+			winner = tagged
+		}
+
+		if len(winner) == 1 && slices.Equal(winner[0].path, candidate.path) {
+			dominant = append(dominant, candidate)
+		}
 	}
 
-	return reflect.StructOf(fields), nil
+	return dominant
 }
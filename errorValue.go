@@ -0,0 +1,257 @@
+package unsafely
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"reflect"
+)
+
+func init() {
+	registerCodec(encodeToErrorValue, decodeFromErrorValue)
+
+	builtinSentinelErrors.
+		Add("context.Canceled", context.Canceled).
+		Add("context.DeadlineExceeded", context.DeadlineExceeded).
+		Add("errors.ErrUnsupported", errors.ErrUnsupported).
+		Add("io.EOF", io.EOF).
+		Add("io.ErrClosedPipe", io.ErrClosedPipe).
+		Add("io.ErrNoProgress", io.ErrNoProgress).
+		Add("io.ErrShortBuffer", io.ErrShortBuffer).
+		Add("io.ErrShortWrite", io.ErrShortWrite).
+		Add("io.ErrUnexpectedEOF", io.ErrUnexpectedEOF).
+		Add("io/fs.ErrClosed", fs.ErrClosed).
+		Add("io/fs.ErrExist", fs.ErrExist).
+		Add("io/fs.ErrInvalid", fs.ErrInvalid).
+		Add("io/fs.ErrNotExist", fs.ErrNotExist).
+		Add("io/fs.ErrPermission", fs.ErrPermission).
+		Add("os.ErrDeadlineExceeded", os.ErrDeadlineExceeded).
+		Add("os.ErrNoDeadline", os.ErrNoDeadline).
+		Add("os.ErrProcessDone", os.ErrProcessDone)
+}
+
+// The sentinel errors in the standard library, which are always recognized.
+var builtinSentinelErrors = NewSentinelErrors()
+
+// SentinelErrors is a registry of named sentinel errors, e.g, io.EOF. Sentinel
+// errors are encoded by name, and decoded as the same error, so errors.Is
+// works for unmarshaled errors.
+//
+// Sentinel errors are well-known instances that are only recognized in error
+// values; see WellKnownInstances. Sentinel errors in the standard library are
+// always recognized.
+type SentinelErrors struct {
+	instances WellKnownInstances
+}
+
+// NewSentinelErrors returns a new SentinelErrors.
+func NewSentinelErrors() SentinelErrors {
+	return SentinelErrors{instances: NewWellKnownInstances()}
+}
+
+// Add adds the sentinel error with the given name, e.g, "example.com/pkg.ErrNotFound".
+//
+// Panics if the error is nil, or if it is not comparable.
+func (s SentinelErrors) Add(name string, err error) SentinelErrors {
+	s.instances.Add(name, err)
+	return s
+}
+
+// Returns the name of the sentinel error, if it is one.
+func (s SentinelErrors) nameOf(err error) (string, bool) {
+	return s.instances.nameOf(reflect.ValueOf(err))
+}
+
+// Returns the sentinel error with the name, if any.
+func (s SentinelErrors) lookup(name string) (error, bool) {
+	instanceV, ok := s.instances.instances[name]
+	if !ok {
+		return nil, false
+	}
+
+	err, ok := instanceV.Interface().(error)
+	return err, ok
+}
+
+// Represents an error stored in an error field.
+type errorValue struct {
+	// The name of the error, if it is a sentinel error; see SentinelErrors.
+	Sentinel string `json:"sentinel,omitempty"`
+
+	// The name of the error, if it is a well-known instance; see WithWellKnown.
+	WellKnown string `json:"wellKnown,omitempty"`
+
+	// The concrete type of the error.
+	typeValue
+
+	// The encoded concrete value of the error, like interfaceValue.Value. This
+	// is omitted for the errors in Wrapped, which are only used if the type
+	// can't be resolved.
+	Value json.RawMessage `json:"value,omitempty"`
+
+	Message string `json:"message"`
+
+	// The errors returned by the error's Unwrap method, if any.
+	Wrapped []*errorValue `json:"wrapped,omitempty"`
+}
+
+// UnmarshaledError is the error that errors are unmarshaled as if they are not
+// sentinel errors and their concrete types can't be resolved. It has the message and the type of the original error, and
+// the unmarshaled errors that the original error wrapped, so errors.Is and
+// errors.As work with the wrapped errors.
+//
+// Note: Since Unwrap returns a slice, errors.Unwrap returns nil for
+// UnmarshaledError.
+type UnmarshaledError struct {
+	// The concrete type of the original error, e.g, "*io/fs.PathError".
+	Type string
+
+	Message string
+
+	Wrapped []error
+}
+
+// Error implements the error interface.
+func (e *UnmarshaledError) Error() string {
+	return e.Message
+}
+
+// Unwrap returns the wrapped errors.
+func (e *UnmarshaledError) Unwrap() []error {
+	return e.Wrapped
+}
+
+func encodeToErrorValue(s *JSONEncoder, in *error) (*errorValue, error) {
+	if *in == nil {
+		return nil, nil
+	}
+
+	ev := s.newErrorValue(*in)
+	if ev.Sentinel != "" {
+		return ev, nil
+	}
+
+	// The concrete value is encoded like an interface value, so the error is
+	// restored if its type can be resolved when decoding.
+	ivV, err := s.encodeToInterfaceValue(reflect.ValueOf(in).Elem())
+	if err != nil {
+		return nil, fmt.Errorf("encodeToErrorValue: %w", err)
+	}
+
+	iv := ivV.Interface().(*interfaceValue)
+	ev.WellKnown, ev.Value = iv.WellKnown, iv.Value
+	if iv.WellKnown != "" {
+		ev.typeValue, ev.Wrapped = typeValue{}, nil
+	}
+
+	return ev, nil
+}
+
+// Returns the errorValue for the non-nil error, including the errors that it
+// wraps, but not the concrete values of the errors.
+func (s *JSONEncoder) newErrorValue(err error) *errorValue {
+	ev := &errorValue{Message: err.Error()}
+
+	name, ok := s.config.sentinelErrors.nameOf(err)
+	if !ok {
+		name, ok = builtinSentinelErrors.nameOf(err)
+	}
+	if ok {
+		ev.Sentinel = name
+		return ev
+	}
+
+	ev.typeValue = newTypeValue(reflect.TypeOf(err))
+
+	var wrapped []error
+	switch err := err.(type) {
+	case interface{ Unwrap() error }:
+		wrapped = []error{err.Unwrap()}
+	case interface{ Unwrap() []error }:
+		wrapped = err.Unwrap()
+	}
+
+	for _, wrappedErr := range wrapped {
+		if wrappedErr != nil {
+			ev.Wrapped = append(ev.Wrapped, s.newErrorValue(wrappedErr))
+		}
+	}
+
+	return ev
+}
+
+func decodeFromErrorValue(s *JSONDecoder, ev *errorValue, out *error) error {
+	if ev == nil {
+		return nil
+	}
+
+	err, decodeErr := s.decodeError(ev)
+	if decodeErr != nil {
+		return fmt.Errorf("decodeFromErrorValue: %w", decodeErr)
+	}
+
+	*out = err
+	return nil
+}
+
+// Returns the error for the errorValue. Sentinel errors and well-known
+// instances are resolved by name, and other errors are decoded from their
+// concrete values. If the concrete type can't be resolved, e.g, if no type
+// resolver is configured, returns an UnmarshaledError.
+func (s *JSONDecoder) decodeError(ev *errorValue) (error, error) {
+	if ev.WellKnown == "" {
+		if ev.Sentinel != "" || ev.Value == nil {
+			return s.newUnmarshaledError(ev)
+		}
+
+		if _, err := s.resolveTypeValue(ev.typeValue); err != nil {
+			return s.newUnmarshaledError(ev)
+		}
+	}
+
+	iv := &interfaceValue{WellKnown: ev.WellKnown, typeValue: ev.typeValue, Value: ev.Value}
+	decodedV, err := s.decodeFromInterfaceValue(reflect.ValueOf(iv))
+	if err != nil {
+		return nil, err
+	}
+
+	decoded, ok := decodedV.Interface().(error)
+	if !ok {
+		return nil, fmt.Errorf("decodeError(): %v does not implement error", decodedV.Type())
+	}
+
+	return decoded, nil
+}
+
+// Returns the sentinel error for the errorValue, or an UnmarshaledError.
+func (s *JSONDecoder) newUnmarshaledError(ev *errorValue) (error, error) {
+	if ev.Sentinel != "" {
+		if err, ok := s.config.sentinelErrors.lookup(ev.Sentinel); ok {
+			return err, nil
+		}
+		if err, ok := builtinSentinelErrors.lookup(ev.Sentinel); ok {
+			return err, nil
+		}
+
+		return nil, fmt.Errorf("unknown sentinel error %s; see WithSentinelErrorResolver", ev.Sentinel)
+	}
+
+	unmarshaled := &UnmarshaledError{Type: ev.typeValue.String(), Message: ev.Message}
+	for _, wrappedEV := range ev.Wrapped {
+		if wrappedEV == nil {
+			continue
+		}
+
+		wrapped, err := s.newUnmarshaledError(wrappedEV)
+		if err != nil {
+			return nil, err
+		}
+		unmarshaled.Wrapped = append(unmarshaled.Wrapped, wrapped)
+	}
+
+	return unmarshaled, nil
+}
@@ -0,0 +1,235 @@
+package unsafely
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+)
+
+// The types used to represent floats in encoded values, with and without NaN
+// payloads; see WithNaNPayloads.
+var (
+	encodedFloat32Type    = reflect.TypeFor[encodedFloat32]()
+	encodedFloat64Type    = reflect.TypeFor[encodedFloat64]()
+	nanPayloadFloat32Type = reflect.TypeFor[nanPayloadFloat32]()
+	nanPayloadFloat64Type = reflect.TypeFor[nanPayloadFloat64]()
+)
+
+// Represent floats. Finite floats are marshaled as JSON numbers, like
+// encoding/json. JSON doesn't support NaN and infinities, and encoding/json
+// drops the sign of negative zero, so these are marshaled as specialFloat.
+type (
+	encodedFloat32    float32
+	encodedFloat64    float64
+	nanPayloadFloat32 float32
+	nanPayloadFloat64 float64
+)
+
+// A float that isn't represented by a JSON number, e.g, {"float":"NaN"}.
+type specialFloat struct {
+	// One of "NaN", "+Inf", "-Inf" or "-0".
+	Float string `json:"float"`
+
+	// The bits of a NaN in hex, including its payload; see WithNaNPayloads.
+	Bits string `json:"bits,omitempty"`
+
+	// Numbers NaN map keys that would otherwise be encoded the same, since maps
+	// may have any number of NaN keys. The second such key has Key 2, etc.
+	Key int `json:"key,omitempty"`
+}
+
+// MarshalJSON implements json.Marshaler.
+func (f encodedFloat32) MarshalJSON() ([]byte, error) {
+	return marshalFloat(uint64(math.Float32bits(float32(f))), 32, false)
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (f *encodedFloat32) UnmarshalJSON(b []byte) error {
+	return unmarshalFloat32(b, (*float32)(f))
+}
+
+// MarshalJSON implements json.Marshaler.
+func (f encodedFloat64) MarshalJSON() ([]byte, error) {
+	return marshalFloat(math.Float64bits(float64(f)), 64, false)
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (f *encodedFloat64) UnmarshalJSON(b []byte) error {
+	return unmarshalFloat64(b, (*float64)(f))
+}
+
+// MarshalJSON implements json.Marshaler.
+func (f nanPayloadFloat32) MarshalJSON() ([]byte, error) {
+	return marshalFloat(uint64(math.Float32bits(float32(f))), 32, true)
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (f *nanPayloadFloat32) UnmarshalJSON(b []byte) error {
+	return unmarshalFloat32(b, (*float32)(f))
+}
+
+// MarshalJSON implements json.Marshaler.
+func (f nanPayloadFloat64) MarshalJSON() ([]byte, error) {
+	return marshalFloat(math.Float64bits(float64(f)), 64, true)
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (f *nanPayloadFloat64) UnmarshalJSON(b []byte) error {
+	return unmarshalFloat64(b, (*float64)(f))
+}
+
+// Returns the type used to represent floats of the kind.
+func encodedFloatType(options encodingOptions, kind reflect.Kind) reflect.Type {
+	switch {
+	case kind == reflect.Float32 && options.NaNPayloads:
+		return nanPayloadFloat32Type
+	case kind == reflect.Float32:
+		return encodedFloat32Type
+	case options.NaNPayloads:
+		return nanPayloadFloat64Type
+	default:
+		return encodedFloat64Type
+	}
+}
+
+// Marshals the float with the bits, which has the bit size.
+func marshalFloat(bits uint64, bitSize int, payloads bool) ([]byte, error) {
+	var f float64
+	if bitSize == 32 {
+		f = float64(math.Float32frombits(uint32(bits)))
+	} else {
+		f = math.Float64frombits(bits)
+	}
+
+	var special specialFloat
+	switch {
+	case math.IsNaN(f):
+		special.Float = "NaN"
+		if payloads {
+			special.Bits = "0x" + strconv.FormatUint(bits, 16)
+		}
+	case math.IsInf(f, 1):
+		special.Float = "+Inf"
+	case math.IsInf(f, -1):
+		special.Float = "-Inf"
+	case f == 0 && math.Signbit(f):
+		special.Float = "-0"
+	case bitSize == 32:
+		return json.Marshal(float32(f))
+	default:
+		return json.Marshal(f)
+	}
+
+	return json.Marshal(special)
+}
+
+// Unmarshals a float32 from a JSON number or specialFloat.
+func unmarshalFloat32(b []byte, out *float32) error {
+	special, ok, err := unmarshalSpecialFloat(b)
+	if err != nil {
+		return err
+	} else if !ok {
+		return json.Unmarshal(b, out)
+	}
+
+	if special.Bits != "" {
+		bits, err := strconv.ParseUint(special.Bits, 0, 32)
+		if err != nil {
+			return fmt.Errorf("unmarshalFloat32(): invalid bits %q: %w", special.Bits, err)
+		}
+
+		*out = math.Float32frombits(uint32(bits))
+		return nil
+	}
+
+	f, err := parseSpecialFloat(special.Float)
+	if err != nil {
+		return fmt.Errorf("unmarshalFloat32(): %w", err)
+	}
+
+	*out = float32(f)
+	return nil
+}
+
+// Unmarshals a float64 from a JSON number or specialFloat.
+func unmarshalFloat64(b []byte, out *float64) error {
+	special, ok, err := unmarshalSpecialFloat(b)
+	if err != nil {
+		return err
+	} else if !ok {
+		return json.Unmarshal(b, out)
+	}
+
+	if special.Bits != "" {
+		bits, err := strconv.ParseUint(special.Bits, 0, 64)
+		if err != nil {
+			return fmt.Errorf("unmarshalFloat64(): invalid bits %q: %w", special.Bits, err)
+		}
+
+		*out = math.Float64frombits(bits)
+		return nil
+	}
+
+	f, err := parseSpecialFloat(special.Float)
+	if err != nil {
+		return fmt.Errorf("unmarshalFloat64(): %w", err)
+	}
+
+	*out = f
+	return nil
+}
+
+// Unmarshals the specialFloat, if the JSON is an object.
+func unmarshalSpecialFloat(b []byte) (specialFloat, bool, error) {
+	var special specialFloat
+	if b = bytes.TrimSpace(b); len(b) == 0 || b[0] != '{' {
+		return special, false, nil
+	}
+
+	if err := json.Unmarshal(b, &special); err != nil {
+		return special, false, err
+	}
+
+	return special, true, nil
+}
+
+// Returns the float for the name of the specialFloat.
+func parseSpecialFloat(name string) (float64, error) {
+	switch name {
+	case "NaN":
+		return math.NaN(), nil
+	case "+Inf":
+		return math.Inf(1), nil
+	case "-Inf":
+		return math.Inf(-1), nil
+	case "-0":
+		return math.Copysign(0, -1), nil
+	}
+
+	return 0, fmt.Errorf("invalid special float %q; expected NaN, +Inf, -Inf or -0", name)
+}
+
+// Returns true if the map key is a NaN float; see specialFloat.Key.
+func isNaNKey(keyV reflect.Value) bool {
+	return isFloat(keyV.Kind()) && math.IsNaN(keyV.Float())
+}
+
+// Returns the encoded map key for the encoded NaN key, numbered with n; see
+// specialFloat.Key.
+func numberNaNKey(encodedKey string, n int) (string, error) {
+	var special specialFloat
+	if err := json.Unmarshal([]byte(encodedKey), &special); err != nil {
+		return "", fmt.Errorf("numberNaNKey(): %w", err)
+	}
+
+	special.Key = n
+	b, err := json.Marshal(special)
+	if err != nil {
+		return "", fmt.Errorf("numberNaNKey(): %w", err)
+	}
+
+	return string(b), nil
+}
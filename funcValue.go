@@ -0,0 +1,119 @@
+package unsafely
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/outriggerlabs/unsafely/typeutil"
+)
+
+// The type used to represent functions in encoded structs.
+var funcValueType = reflect.TypeFor[*funcValue]()
+
+// Returns true if the provided type is a *funcValue.
+func isFuncValueType(t reflect.Type) bool {
+	return t == funcValueType
+}
+
+// Represents a function by its symbol name. If the funcValue is nil, the
+// function was nil.
+type funcValue struct {
+	// Name is the fully qualified symbol name; see typeutil.FuncName.
+	Name string `json:"name,omitempty"`
+
+	// Closure is true if the function is a closure or method value. The state
+	// captured by these functions is not encoded.
+	Closure bool `json:"closure,omitempty"`
+
+	// Placeholder is set instead of the name if the symbol name could not be
+	// found; see WithPlaceholders.
+	Placeholder *Placeholder `json:"placeholder,omitempty"`
+}
+
+// Encodes the function to a funcValue object.
+//
+// If the function is nil, returns a nil *funcValue.
+func (s *JSONEncoder) encodeToFuncValue(inV reflect.Value) (reflect.Value, error) {
+	if inV.Kind() != reflect.Func {
+		return zeroValue, fmt.Errorf("encodeToFuncValue: expected value to be a func; received %v", inV.Kind())
+	}
+
+	if inV.IsNil() {
+		return reflect.ValueOf((*funcValue)(nil)), nil
+	}
+
+	name, isClosure := typeutil.FuncName(inV)
+	if name == "" {
+		err := fmt.Errorf("encodeToFuncValue: could not find the symbol name for %v", inV.Type())
+		if !s.config.encoding.Placeholders {
+			return zeroValue, err
+		}
+
+		placeholder := s.newPlaceholder(inV, err.Error())
+		return reflect.ValueOf(&funcValue{Placeholder: &placeholder}), nil
+	}
+
+	return reflect.ValueOf(&funcValue{Name: name, Closure: isClosure}), nil
+}
+
+// Decodes the funcValue object and writes the function to outV.
+func (s *JSONDecoder) decodeFromFuncValue(encodedV, outV reflect.Value) error {
+	fv, ok := encodedV.Interface().(*funcValue)
+	if !ok {
+		return fmt.Errorf(
+			"decodeFromFuncValue: expected encodedV to be a *funcValue; received %T",
+			encodedV.Interface(),
+		)
+	}
+
+	if outV.Kind() != reflect.Func {
+		return fmt.Errorf("decodeFromFuncValue: expected outV to be a func; received %v", outV.Kind())
+	}
+
+	// Nil function; outV should already be nil.
+	if fv == nil {
+		return nil
+	}
+
+	if fv.Placeholder != nil {
+		return s.decodeFromPlaceholder(reflect.ValueOf(*fv.Placeholder))
+	}
+
+	var (
+		fnV reflect.Value
+		err error
+	)
+
+	switch {
+	case fv.Closure && !s.config.closureResolution:
+		// The resolved function would not have the captured state of the closure.
+		err = fmt.Errorf(
+			"%s is a closure or method value, whose captured state is not encoded; "+
+				"use WithClosureResolution() to resolve it by name", fv.Name,
+		)
+	case s.config.funcResolver != nil:
+		fnV, err = s.config.funcResolver.ResolveFunc(fv.Name, outV.Type())
+	default:
+		err = errors.New("a function resolver must be configured using WithFuncResolver() to resolve functions")
+	}
+
+	if err != nil {
+		if !s.config.funcPlaceholders {
+			return fmt.Errorf("decodeFromFuncValue: %w", err)
+		}
+
+		fnV = funcPlaceholder(fv.Name, outV.Type())
+	}
+
+	setField(outV, fnV)
+	return nil
+}
+
+// Returns a function of type funcT that panics when called, for functions
+// that could not be resolved; see WithFuncPlaceholders.
+func funcPlaceholder(name string, funcT reflect.Type) reflect.Value {
+	return reflect.MakeFunc(funcT, func([]reflect.Value) []reflect.Value {
+		panic(fmt.Sprintf("unsafely: called placeholder for unresolved function %s", name))
+	})
+}
@@ -2,7 +2,6 @@ package unsafely
 
 import (
 	"encoding/json"
-	"errors"
 	"fmt"
 	"reflect"
 )
@@ -18,21 +17,15 @@ func isInterfaceValueType(t reflect.Type) bool {
 // Represents a value that was stored in an interface field. If the
 // interfaceValue is nil, the underlying value was a nil interface.
 type interfaceValue struct {
-	// PtrDepth is the number of pointer indirections to the type for the value.
-	PtrDepth int `json:"ptrDepth,omitempty"`
+	// If set, the underlying value is the well-known instance with the name, and
+	// the type and value are omitted; see WithWellKnown.
+	WellKnown string `json:"wellKnown,omitempty"`
 
-	// PkgPath is the package path of the type; empty for built-in types.
-	PkgPath string `json:"pkgPath,omitempty"`
-
-	// TypeName is the name of the type, namespaced by PkgPath.
-	TypeName string `json:"typeName,omitempty"`
-
-	// TypeString is the string representation of the type, only included if the
-	// PkgPath and TypeName are empty.
-	TypeString string `json:"typeString,omitempty"`
+	// The type of the underlying value.
+	typeValue
 
 	// Value is a JSON string representing the underlying value.
-	Value json.RawMessage `json:"value"`
+	Value json.RawMessage `json:"value,omitempty"`
 }
 
 // Encodes the value to an interfaceValue object.
@@ -53,6 +46,10 @@ func (s *JSONEncoder) encodeToInterfaceValue(inV reflect.Value) (out reflect.Val
 		return zeroValue, nil
 	}
 
+	if name, ok := s.config.wellKnown.nameOf(inV); ok {
+		return reflect.ValueOf(&interfaceValue{WellKnown: name}), nil
+	}
+
 	// inV is the interface type; decodedV is the underlying type.
 	decodedV := ensureAddressable(inV.Elem())
 
@@ -67,36 +64,9 @@ func (s *JSONEncoder) encodeToInterfaceValue(inV reflect.Value) (out reflect.Val
 		return zeroValue, fmt.Errorf("encodeToInterfaceValue: %w", err)
 	}
 
-	// Pointers seem to have no package path or name, and the string
-	// representation isn't canonical.
-	//
-	// To capture a concrete type, we extract the underlying type of the pointer
-	// and record that and the pointer depth separately.
-	var (
-		pointerDepth int
-		recordedT    = decodedV.Type()
-	)
-	for recordedT.Kind() == reflect.Pointer {
-		pointerDepth++
-		recordedT = recordedT.Elem()
-	}
-
-	var (
-		pkgPath    = recordedT.PkgPath()
-		typeName   = recordedT.Name()
-		typeString string
-	)
-
-	if pkgPath == "" && typeName == "" {
-		typeString = recordedT.String()
-	}
-
 	iv := &interfaceValue{
-		PtrDepth:   pointerDepth,
-		PkgPath:    pkgPath,
-		TypeName:   typeName,
-		TypeString: typeString,
-		Value:      encodedBytes,
+		typeValue: newTypeValue(decodedV.Type()),
+		Value:     encodedBytes,
 	}
 
 	return reflect.ValueOf(iv), nil
@@ -119,24 +89,21 @@ func (s *JSONDecoder) decodeFromInterfaceValue(inV reflect.Value) (reflect.Value
 		return zeroValue, nil
 	}
 
-	if s.config.typeResolver == nil {
-		return zeroValue, errors.New(
-			"decodeFromInterfaceValue(): a type resolver must be configured using WithTypeResolver() " +
-				"to resolve types to interface values")
+	if iv.WellKnown != "" {
+		instanceV, err := s.resolveWellKnown(iv.WellKnown)
+		if err != nil {
+			return zeroValue, fmt.Errorf("decodeFromInterfaceValue(): %w", err)
+		}
+
+		return instanceV, nil
 	}
 
-	resolvedT, err := s.config.typeResolver.ResolveType(iv.PkgPath, iv.TypeName, iv.TypeString)
+	decodedT, err := s.resolveTypeValue(iv.typeValue)
 	if err != nil {
 		return zeroValue, fmt.Errorf("decodeFromInterfaceValue(): %w", err)
 	}
 
-	// Add the pointer indirections recorded in the pointer depth.
-	decodedT := resolvedT
-	for range iv.PtrDepth {
-		decodedT = reflect.PointerTo(decodedT)
-	}
-
-	encodedT, err := encodedTypeFor(decodedT)
+	encodedT, err := encodedTypeFor(s.options, decodedT)
 	if err != nil {
 		return zeroValue, fmt.Errorf("decodeFromInterfaceValue(): %w", err)
 	}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"reflect"
+	"time"
 )
 
 // JSONDecoder is a helper struct for reconstructing objects marshaled with
@@ -13,16 +14,30 @@ import (
 type JSONDecoder struct {
 	config unmarshalJSONConfig
 
-	// Map from pointer indices to their decoded values.
-	pointerValues map[int]reflect.Value
+	// The encoding options for the value that is being decoded.
+	options encodingOptions
+
+	// Map from pointer IDs to their decoded values.
+	pointerValues map[pointerID]reflect.Value
+
+	// Map from pointer IDs to pointers that are waiting for the values to be
+	// decoded.
+	unresolved map[pointerID][]*pointerFixup
+
+	// Fixups created during the current call to Decode; see watchFixups.
+	fixupLog []*pointerFixup
+
+	// Map from location names to locations loaded by name.
+	locations map[string]*time.Location
 }
 
 // NewJSONDecoder creates a JSONDecoder with the given options.
 //
 // If the same JSONDecoder is used to unmarshal multiple values that share the
-// same pointer reference numbers, e.g, they shared pointers and were marshaled
+// same pointer IDs, e.g, they shared pointers and were marshaled
 // with the same JSONEncoder, the output will share the same reconstructed
-// pointer values.
+// pointer values. This includes references to pointers that are decoded in a
+// later call; see UnresolvedPointers.
 func NewJSONDecoder(options ...UnmarshalJSONOption) *JSONDecoder {
 	var config unmarshalJSONConfig
 	for _, opt := range options {
@@ -31,7 +46,8 @@ func NewJSONDecoder(options ...UnmarshalJSONOption) *JSONDecoder {
 
 	return &JSONDecoder{
 		config:        config,
-		pointerValues: make(map[int]reflect.Value),
+		pointerValues: make(map[pointerID]reflect.Value),
+		unresolved:    make(map[pointerID][]*pointerFixup),
 	}
 }
 
@@ -48,6 +64,12 @@ func (s *JSONDecoder) Decode(b []byte, outPtr any) error {
 		return fmt.Errorf("JSONDecoder.Decode(): %w", err)
 	}
 
+	// Decode using the options that were used to encode the value.
+	s.options = encodingOptions{}
+	if wrapper.Options != nil {
+		s.options = *wrapper.Options
+	}
+
 	var (
 		outPtrV = reflect.ValueOf(outPtr)
 		outPtrT = outPtrV.Type()
@@ -62,7 +84,7 @@ func (s *JSONDecoder) Decode(b []byte, outPtr any) error {
 		outT = outV.Type()
 	)
 
-	encodedT, err := encodedTypeFor(outT)
+	encodedT, err := encodedTypeFor(s.options, outT)
 	if err != nil {
 		return fmt.Errorf("JSONDecoder.Decode(): %w", err)
 	}
@@ -78,6 +100,7 @@ func (s *JSONDecoder) Decode(b []byte, outPtr any) error {
 	}
 
 	// Decode the encoded value into the output value.
+	defer func() { s.fixupLog = nil }()
 	if err := s.decodeTo(encodedV, outV); err != nil {
 		return fmt.Errorf("JSONDecoder.Decode(): %w", err)
 	}
@@ -95,20 +118,21 @@ func (s *JSONDecoder) decodeTo(encodedV, decodedV reflect.Value) error {
 		decodedKind = decodedT.Kind()
 	)
 
-	// If the original decoded value implements json.Marshaler, then we used the
-	// existing mechanism to marshal the value. We use the standard json.Unmarshal
-	// function so we'll invoke the json.Unmarshaler mechanism, if defined.
-	if decodedT.Implements(jsonMarshalerType) {
-		encodedMessage := encodedV.Interface().(json.RawMessage)
-		decodedPtr := decodedV.Addr().Interface()
+	// Some types have built-in codecs, e.g, time.Time.
+	if c, ok := codecFor(decodedT); ok {
+		return s.decodeWithCodec(c, encodedV, decodedV)
+	}
 
-		if err := json.Unmarshal(encodedMessage, decodedPtr); err != nil {
-			return fmt.Errorf("decodeTo(): failed to unmarshal to type %s, raw message: %s, err: %w",
-				decodedT.String(), string(encodedMessage), err,
-			)
-		}
+	// If the original decoded value has a marshaler, e.g, json.Marshaler, then we
+	// used the existing mechanism to marshal the value, so we use the matching
+	// unmarshaler.
+	if kind := marshalerKindFor(s.options, decodedT); kind != noMarshaler {
+		return s.decodeWithMarshaler(kind, encodedV, decodedV)
+	}
 
-		return nil
+	// We're decoding a channel, which is referenced like a pointer.
+	if decodedKind == reflect.Chan {
+		return s.decodeFromChanValue(encodedV, decodedV)
 	}
 
 	// We're decoding a pointerValue.
@@ -118,19 +142,54 @@ func (s *JSONDecoder) decodeTo(encodedV, decodedV reflect.Value) error {
 
 	// We're decoding an interfaceValue.
 	if isInterfaceValueType(encodedT) {
-		decodedOutputV, err := s.decodeFromInterfaceValue(encodedV)
+		var decodedOutputV reflect.Value
+		err := s.watchFixups(
+			func() (err error) {
+				decodedOutputV, err = s.decodeFromInterfaceValue(encodedV)
+				return err
+			},
+			func() { setField(decodedV, decodedOutputV) },
+		)
 		if err != nil {
 			return fmt.Errorf("decodeTo(): %w", err)
 		}
 
 		// A zero value implies the interface was nil, which is the default value.
 		if decodedOutputV != zeroValue {
+			if !decodedOutputV.Type().AssignableTo(decodedT) {
+				return fmt.Errorf("decodeTo(): %v does not implement %v", decodedOutputV.Type(), decodedT)
+			}
 			setField(decodedV, decodedOutputV)
 		}
 
 		return nil
 	}
 
+	// We're decoding a sliceValue.
+	if isSliceValueType(encodedT) {
+		return s.decodeFromSliceValue(encodedV, decodedV)
+	}
+
+	// We're decoding an unsafePointerValue.
+	if isUnsafePointerValueType(encodedT) {
+		return s.decodeFromUnsafePointerValue(encodedV, decodedV)
+	}
+
+	// We're decoding a placeholder for an unsupported value.
+	if isPlaceholderValueType(encodedT) {
+		return s.decodeFromPlaceholder(encodedV)
+	}
+
+	// We're decoding a funcValue.
+	if isFuncValueType(encodedT) {
+		return s.decodeFromFuncValue(encodedV, decodedV)
+	}
+
+	// We're decoding bytes from text or hex; see WithReadableOutput.
+	if isReadableBytesType(encodedT) {
+		return decodeFromReadableBytes(encodedV, decodedV)
+	}
+
 	// We're decoding a complexValue.
 	if isComplexValueType(encodedT) {
 		return decodeFromComplexValue(encodedV, decodedV)
@@ -156,7 +215,7 @@ func (s *JSONDecoder) decodeTo(encodedV, decodedV reflect.Value) error {
 			decodedValT = decodedV.Type().Elem()
 		)
 
-		encodedKeyT, err := encodedTypeFor(decodedKeyT)
+		encodedKeyT, err := encodedTypeFor(s.options, decodedKeyT)
 		if err != nil {
 			return fmt.Errorf("decodeTo(): %w", err)
 		}
@@ -166,49 +225,88 @@ func (s *JSONDecoder) decodeTo(encodedV, decodedV reflect.Value) error {
 			var (
 				encodedKey = encodedMapIter.Key()
 				encodedVal = encodedMapIter.Value()
+			)
 
+			// Decode the key and value. If either contains a pointer that has not
+			// been decoded yet, the map entry is updated once it is set.
+			var (
 				decodedKey = encodedKey
+				decodedVal = reflect.New(decodedValT).Elem()
 			)
 
-			// JSON does not support non-primitive keys (e.g, structs, pointers), so
-			// we convert these map keys from JSON strings.
-			if !isSimplePrimitive(decodedKeyT.Kind()) {
-				var (
-					encodedKeyBytes = []byte(encodedKey.String())
-					encodedKeyPtrV  = reflect.New(encodedKeyT)
-					encodedKeyPtr   = encodedKeyPtrV.Interface()
-					encodedKeyV     = encodedKeyPtrV.Elem()
-				)
-
-				// Unmarshal and decode the key from the JSON string.
-				if err := json.Unmarshal(encodedKeyBytes, encodedKeyPtr); err != nil {
-					return fmt.Errorf("decodeTo(): %w", err)
+			decodeEntry := func() error {
+				// Keys with text marshalers are stored as their text. JSON does not
+				// support other non-primitive keys (e.g, structs, pointers), so we
+				// convert these map keys from JSON strings.
+				if isTextMapKey(s.options, decodedKeyT) {
+					decodedKeyV, err := unmarshalTextKey(decodedKeyT, encodedKey.String())
+					if err != nil {
+						return fmt.Errorf("decodeTo(): %w", err)
+					}
+
+					decodedKey = decodedKeyV
+				} else if encodedKey.Kind() == reflect.String && decodedKeyT.Kind() == reflect.String {
+					key, err := unescapeMapKey(encodedKey.String())
+					if err != nil {
+						return fmt.Errorf("decodeTo(): %w", err)
+					}
+
+					decodedKey = reflect.ValueOf(key).Convert(decodedKeyT)
+				} else if encodedKey.Kind() == decodedKeyT.Kind() {
+					decodedKey = encodedKey.Convert(decodedKeyT)
+				} else {
+					var (
+						encodedKeyBytes = []byte(encodedKey.String())
+						encodedKeyPtrV  = reflect.New(encodedKeyT)
+						encodedKeyPtr   = encodedKeyPtrV.Interface()
+						encodedKeyV     = encodedKeyPtrV.Elem()
+					)
+
+					// Unmarshal and decode the key from the JSON string.
+					if err := json.Unmarshal(encodedKeyBytes, encodedKeyPtr); err != nil {
+						return fmt.Errorf("decodeTo(): %w", err)
+					}
+
+					decodedKeyV := reflect.New(decodedKeyT).Elem()
+					if err := s.decodeTo(encodedKeyV, decodedKeyV); err != nil {
+						return fmt.Errorf("decodeTo(): %w", err)
+					}
+
+					decodedKey = decodedKeyV
 				}
 
-				decodedKeyV := reflect.New(decodedKeyT).Elem()
-				if err := s.decodeTo(encodedKeyV, decodedKeyV); err != nil {
+				// Decode the map value.
+				if err := s.decodeTo(encodedVal, decodedVal); err != nil {
 					return fmt.Errorf("decodeTo(): %w", err)
 				}
 
-				decodedKey = decodedKeyV
+				return nil
+			}
+
+			// The key may change when a pointer in it is set, so we replace the
+			// previous entry using a copy of the key.
+			var setKey reflect.Value
+			updateEntry := func() {
+				decodedMap.SetMapIndex(setKey, zeroValue)
+				setKey = copyValue(decodedKey)
+				decodedMap.SetMapIndex(setKey, decodedVal)
 			}
 
-			// Decode the map value.
-			decodedVal := reflect.New(decodedValT).Elem()
-			if err := s.decodeTo(encodedVal, decodedVal); err != nil {
-				return fmt.Errorf("decodeTo(): %w", err)
+			if err := s.watchFixups(decodeEntry, updateEntry); err != nil {
+				return err
 			}
 
+			setKey = copyValue(decodedKey)
 			// Set the key and value on the decoded map.
-			decodedMap.SetMapIndex(decodedKey, decodedVal)
+			decodedMap.SetMapIndex(setKey, decodedVal)
 		}
 
 		return nil
 	}
 
 	if encodedKind == reflect.Struct {
-		return copyStruct(s.decodeTo, encodedV, decodedV, false /* isEncode */)
+		return copyStruct(s.decodeTo, s.decodeFromHintedUnsafePointer, nil, encodedV, decodedV, false /* isEncode */)
 	}
 
-	return copyCommon(s.decodeTo, encodedV, decodedV)
+	return copyCommon(s.decodeTo, nil, encodedV, decodedV)
 }
@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"reflect"
+	"slices"
+	"time"
 	"unsafe"
 )
 
@@ -17,10 +19,57 @@ type JSONEncoder struct {
 	pointerIndex int
 
 	// Map from pointers to previously encoded values.
-	pointerValues map[unsafe.Pointer]reflect.Value
+	pointerValues map[pointerKey]reflect.Value
 
-	// Pointers that are in processing, to avoid cycles.
-	pendingPointers map[unsafe.Pointer]struct{}
+	// Map from pointers to their IDs.
+	pointerIDs map[pointerKey]pointerID
+
+	// Pointers that are in processing, used to detect cycles.
+	pendingPointers map[pointerKey]struct{}
+
+	// The memory referenced by pointers, used to find pointers into the values
+	// of other pointers.
+	pointerRegions *pointerRegions
+
+	// Set when we're collecting the pointerRegions before encoding.
+	dryRun bool
+
+	// Set when the pointerRegions are collected in the traversal before
+	// encoding, which skips work that can't affect the regions; see
+	// collectPointerRegions.
+	collectingRegions bool
+
+	// Releases the locks acquired while collecting the pointerRegions, which
+	// are held until the value is encoded; see WithLockedSnapshots.
+	regionUnlocks []func()
+
+	// Set when encoding a shallow sort key, which doesn't include the values
+	// of nested pointers and maps; see sortKeyFor.
+	shallow bool
+
+	// The number of references whose values are being encoded.
+	referenceDepth int
+
+	// Map from pointers to their shallow sort keys, for the current call to
+	// Encode. This is shared with nested encoders.
+	sortKeys map[pointerKey]string
+
+	// The Go path of the value being encoded, if using WithPlaceholders.
+	goPath *goPath
+
+	// The unsupported values that were replaced by placeholders.
+	placeholders []Placeholder
+
+	// Map from location names to the locations loaded by name, or nil if they
+	// can't be loaded; see loadLocation.
+	loadedLocations map[string]*time.Location
+
+	// The locks held while encoding structs; see WithLockedSnapshots. This is
+	// shared with nested encoders, so these don't acquire the locks again.
+	heldLocks map[unsafe.Pointer]struct{}
+
+	// Rewrites pointer IDs after encoding, unless using PostOrderPointerIDs.
+	pointerIDRewriter *pointerIDRewriter
 }
 
 // NewJSONEncoder creates a JSONEncoder with the given options.
@@ -35,11 +84,28 @@ func NewJSONEncoder(options ...MarshalJSONOption) *JSONEncoder {
 		opt(&config)
 	}
 
-	return &JSONEncoder{
+	encoder := &JSONEncoder{
 		config:          config,
-		pointerValues:   make(map[unsafe.Pointer]reflect.Value),
-		pendingPointers: make(map[unsafe.Pointer]struct{}),
+		pointerValues:   make(map[pointerKey]reflect.Value),
+		pointerIDs:      make(map[pointerKey]pointerID),
+		pendingPointers: make(map[pointerKey]struct{}),
+		pointerRegions:  newPointerRegions(),
+		sortKeys:        make(map[pointerKey]string),
+	}
+
+	if config.pointerIDs != PostOrderPointerIDs {
+		encoder.pointerIDRewriter = newPointerIDRewriter(config.pointerIDs)
+	}
+
+	if config.encoding.Placeholders {
+		encoder.goPath = &goPath{}
 	}
+
+	if config.lockedSnapshots {
+		encoder.heldLocks = make(map[unsafe.Pointer]struct{})
+	}
+
+	return encoder
 }
 
 // Encode serializes the value to a JSON string, including unexported
@@ -47,14 +113,34 @@ func NewJSONEncoder(options ...MarshalJSONOption) *JSONEncoder {
 //
 // See the package notes for restrictions, limitations and options.
 func (s *JSONEncoder) Encode(in any) ([]byte, error) {
-	var (
-		inV     = reflect.ValueOf(in)
-		encoded any
-	)
-
+	inV := reflect.ValueOf(in)
 	if inV.IsValid() /* non-nil */ {
 		inV = ensureAddressable(inV)
+	}
+
+	return s.encodeValue(inV)
+}
 
+// Encodes the addressable value, or nil if the value is invalid; see Encode.
+func (s *JSONEncoder) encodeValue(inV reflect.Value) ([]byte, error) {
+	var encoded any
+
+	// Placeholders are only reported for the current call to Encode, and the
+	// values may have changed since earlier calls.
+	s.placeholders = nil
+	clear(s.sortKeys)
+
+	if inV.IsValid() /* non-nil */ {
+		// Find the memory referenced by pointers before encoding, so pointers into
+		// other values can be encoded as references, even if they are encoded
+		// before the other values.
+		unlock, err := s.collectPointerRegions(inV)
+		if err != nil {
+			return nil, fmt.Errorf("MarshalJSON: %w", err)
+		}
+		defer unlock()
+
+		s.goPath.reset()
 		encodedV, err := s.encode(inV)
 		if err != nil {
 			return nil, fmt.Errorf("MarshalJSON: %w", err)
@@ -67,23 +153,102 @@ func (s *JSONEncoder) Encode(in any) ([]byte, error) {
 		return nil, fmt.Errorf("MarshalJSON: %w", err)
 	}
 
-	// Wrap the encoded value.
-	//
-	// Future: Add any configuration options required for unmarshaling.
+	// Wrap the encoded value, including any options required for unmarshaling.
 	out := encodedJSONWrapper{
 		Value: encodedBytes,
 	}
 
+	if s.config.encoding != (encodingOptions{}) {
+		out.Options = &s.config.encoding
+	}
+
 	// Output is a single line if prefix and indent are empty; multiline otherwise,
+	var outBytes []byte
 	if s.config.prefix == "" && s.config.indent == "" {
-		return json.Marshal(out)
+		outBytes, err = json.Marshal(out)
+	} else {
+		outBytes, err = json.MarshalIndent(out, s.config.prefix, s.config.indent)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("MarshalJSON: %w", err)
+	}
+
+	// Pointer IDs other than reference numbers depend on where the pointers
+	// appear in the output, so these are rewritten afterwards.
+	if s.pointerIDRewriter != nil {
+		outBytes, err = s.pointerIDRewriter.rewriteDocument(outBytes, s.config.prefix, s.config.indent)
+		if err != nil {
+			return nil, fmt.Errorf("MarshalJSON: %w", err)
+		}
+	}
+
+	// encoding/json escapes HTML characters, which makes the output harder to
+	// read.
+	if s.config.encoding.Readable {
+		outBytes = unescapeHTML(outBytes)
+	}
+
+	return outBytes, nil
+}
+
+// Traverses the value without producing output to collect the memory
+// referenced by pointers in the value, and returns a function that releases
+// the locks acquired while traversing (see WithLockedSnapshots). The locks are
+// held until the value is encoded, so both see the same state.
+//
+// Values whose types can't contain pointers are not traversed. Custom
+// marshalers are not called, since their output can't refer to pointers, and
+// map entries are not sorted.
+func (s *JSONEncoder) collectPointerRegions(inV reflect.Value) (func(), error) {
+	s.pointerRegions.resetCounts()
+	if !mayHaveReferences(s.config.encoding, inV.Type()) {
+		return func() {}, nil
+	}
+
+	collector := s.newDryRunEncoder(s.pointerRegions)
+	collector.collectingRegions = true
+
+	unlockAll := func() {
+		for _, unlock := range slices.Backward(collector.regionUnlocks) {
+			unlock()
+		}
+	}
+
+	if _, err := collector.encode(inV); err != nil {
+		unlockAll()
+		return nil, err
+	}
+
+	return unlockAll, nil
+}
+
+// Returns a JSONEncoder with the same config that doesn't share any pointers
+// with this encoder, and that adds the memory referenced by pointers to the
+// regions. Pointers that this encoder is processing are encoded as
+// back-references, so cycles through the pointers terminate, and the locks
+// held by this encoder are not acquired again.
+func (s *JSONEncoder) newDryRunEncoder(regions *pointerRegions) *JSONEncoder {
+	return &JSONEncoder{
+		config:          s.config,
+		pointerValues:   make(map[pointerKey]reflect.Value),
+		pointerIDs:      make(map[pointerKey]pointerID),
+		pendingPointers: s.pendingPointers,
+		pointerRegions:  regions,
+		dryRun:          true,
+		sortKeys:        s.sortKeys,
+		goPath:          s.goPath,
+		heldLocks:       s.heldLocks,
 	}
-	return json.MarshalIndent(out, s.config.prefix, s.config.indent)
 }
 
 // Marshals an internal value to json. The prefix should only be applied once
 // at the end, but the indent should be applied to internal values.
 func (s *JSONEncoder) jsonMarshalInternal(v any) ([]byte, error) {
+	// The output isn't used when collecting the pointer regions.
+	if s.collectingRegions {
+		return []byte("null"), nil
+	}
+
 	if s.config.prefix == "" && s.config.indent == "" {
 		return json.Marshal(v)
 	}
@@ -103,15 +268,30 @@ func (s *JSONEncoder) encodeTo(originalV, encodedV reflect.Value) error {
 		encodedKind  = encodedT.Kind()
 	)
 
-	// If the value implements json.Marshaler, we defer to the existing marshaling
-	// mechanism and simply store the output.
-	if originalT.Implements(jsonMarshalerType) {
-		b, err := s.jsonMarshalInternal(originalV.Interface())
+	// Some types have built-in codecs, e.g, time.Time.
+	if c, ok := codecFor(originalT); ok {
+		return s.encodeWithCodec(c, originalV, encodedV)
+	}
+
+	// If the value has a marshaler, e.g, json.Marshaler, we defer to the
+	// existing marshaling mechanism and simply store the output.
+	if kind := marshalerKindFor(s.config.encoding, originalT); kind != noMarshaler {
+		// The output of marshalers can't refer to pointers, so these aren't
+		// called when collecting the pointer regions.
+		if s.collectingRegions {
+			return nil
+		}
+		return s.encodeWithMarshaler(kind, originalV, encodedV)
+	}
+
+	// We're encoding a channel, which is referenced like a pointer.
+	if originalKind == reflect.Chan {
+		pv, err := s.encodeToChanValue(originalV)
 		if err != nil {
-			return fmt.Errorf("encodeTo(): custom json.Marshal for %s failed: %w",
-				originalT.String(), err)
+			return err
 		}
-		setField(encodedV, reflect.ValueOf(json.RawMessage(b)))
+
+		setField(encodedV, pv)
 		return nil
 	}
 
@@ -141,9 +321,59 @@ func (s *JSONEncoder) encodeTo(originalV, encodedV reflect.Value) error {
 		return nil
 	}
 
+	// We're encoding a slice that refers to its backing array.
+	if isSliceValueType(encodedT) {
+		sv, err := s.encodeToSliceValue(originalV)
+		if err != nil {
+			return err
+		}
+
+		setField(encodedV, sv)
+		return nil
+	}
+
+	// We're encoding an unsafe pointer.
+	if isUnsafePointerValueType(encodedT) {
+		uv, err := s.encodeToUnsafePointerValue(originalV)
+		if err != nil {
+			return err
+		}
+
+		setField(encodedV, uv)
+		return nil
+	}
+
+	// We're encoding an unsupported value.
+	if isPlaceholderValueType(encodedT) {
+		placeholder, err := s.encodeToPlaceholder(originalV)
+		if err != nil {
+			return err
+		}
+
+		setField(encodedV, placeholder)
+		return nil
+	}
+
+	// We're encoding a function.
+	if isFuncValueType(encodedT) {
+		fv, err := s.encodeToFuncValue(originalV)
+		if err != nil {
+			return err
+		}
+
+		setField(encodedV, fv)
+		return nil
+	}
+
+	// We're encoding bytes as text or hex; see WithReadableOutput.
+	if isReadableBytesType(encodedT) {
+		setField(encodedV, encodeToReadableBytes(originalV))
+		return nil
+	}
+
 	// We're encoding a complex value.
 	if isComplexValueType(encodedT) {
-		cv, err := encodeToComplexValue(originalV)
+		cv, err := encodeToComplexValue(originalV, encodedT)
 		if err != nil {
 			return err
 		}
@@ -164,22 +394,58 @@ func (s *JSONEncoder) encodeTo(originalV, encodedV reflect.Value) error {
 			return nil // The map in encodedV is nil by default.
 		}
 
+		// Shallow sort keys don't include nested maps; see sortKeyFor.
+		if s.shallow && s.referenceDepth > 0 {
+			return nil
+		}
+
+		// Only the pointers in the keys and values matter when collecting the
+		// pointer regions, so the entries aren't sorted or stored.
+		if s.collectingRegions {
+			return s.collectMapRegions(originalV)
+		}
+
 		encodedMap := reflect.MakeMapWithSize(encodedV.Type(), originalV.Len())
 		setField(encodedV, encodedMap)
 
-		// Copy the map keys and values.
-		originalMapIter := originalV.MapRange()
-		for originalMapIter.Next() {
+		// Copy the map keys and values. These are visited in a deterministic
+		// order, so pointers are numbered consistently.
+		entries, err := s.sortedMapEntries(originalV)
+		if err != nil {
+			return fmt.Errorf("encodeTo(): %w", err)
+		}
+
+		// The number of duplicates of each encoded NaN key.
+		nanKeys := map[string]int{}
+
+		for _, entry := range entries {
 			var (
-				originalKey = originalMapIter.Key()
-				originalVal = originalMapIter.Value()
+				originalKey = entry.key
+				originalVal = entry.value
 
 				encodedKey = originalKey
 			)
 
-			// JSON does not support non-primitive keys (e.g, structs, pointers), so
-			// we convert these map keys to JSON strings.
-			if !isSimplePrimitive(originalKey.Kind()) {
+			// Keys with text marshalers are stored as their text, like encoding/json.
+			// JSON does not support other non-primitive keys (e.g, structs,
+			// pointers), so we convert these map keys to JSON strings.
+			if isTextMapKey(s.config.encoding, originalKey.Type()) {
+				text, err := marshalTextKey(originalKey)
+				if err != nil {
+					return fmt.Errorf("encodeTo(): %w", err)
+				}
+
+				encodedKey = reflect.ValueOf(text)
+			} else if encodedKeyT := encodedV.Type().Key(); encodedKeyT.Kind() == originalKey.Kind() {
+				// Primitive keys are stored as-is, but may have a different type; see
+				// WithoutCustomMarshalers.
+				encodedKey = originalKey.Convert(encodedKeyT)
+
+				// String keys may contain invalid UTF-8; see escapeMapKey.
+				if encodedKeyT.Kind() == reflect.String {
+					encodedKey = reflect.ValueOf(escapeMapKey(originalKey.String())).Convert(encodedKeyT)
+				}
+			} else {
 				// The key may not be addressable, e.g, if it is a struct.
 				originalKey = ensureAddressable(originalKey)
 
@@ -202,11 +468,31 @@ func (s *JSONEncoder) encodeTo(originalV, encodedV reflect.Value) error {
 
 			// Encode the map value. The map value may not be addressable, e.g, if
 			// it is a struct.
+			s.goPath.push(mapKeyPath(entry.key))
 			encodedVal, err := s.encode(ensureAddressable(originalVal))
+			s.goPath.pop()
 			if err != nil {
 				return err
 			}
 
+			// Maps may have any number of NaN keys, so these are numbered to keep
+			// them distinct. Other keys that are encoded the same can't be restored,
+			// e.g, structs with NaN fields.
+			if encodedMap.MapIndex(encodedKey).IsValid() && isNaNKey(entry.key) &&
+				!isTextMapKey(s.config.encoding, entry.key.Type()) {
+				nanKeys[encodedKey.String()]++
+				numbered, err := numberNaNKey(encodedKey.String(), nanKeys[encodedKey.String()]+1)
+				if err != nil {
+					return fmt.Errorf("encodeTo(): %w", err)
+				}
+
+				encodedKey = reflect.ValueOf(numbered)
+			}
+
+			if encodedMap.MapIndex(encodedKey).IsValid() {
+				return fmt.Errorf("encodeTo(): duplicate encoded map key %q in %v", encodedKey, originalV.Type())
+			}
+
 			// Set the key and value on the encoded map.
 			encodedMap.SetMapIndex(encodedKey, encodedVal)
 		}
@@ -215,10 +501,42 @@ func (s *JSONEncoder) encodeTo(originalV, encodedV reflect.Value) error {
 	}
 
 	if originalKind == reflect.Struct {
-		return copyStruct(s.encodeTo, originalV, encodedV, true /* isEncode */)
+		unlock, err := s.lockStruct(originalV)
+		if err != nil {
+			return fmt.Errorf("encodeTo(): %w", err)
+		}
+		// Locks acquired while collecting the pointer regions are held until the
+		// value is encoded; see collectPointerRegions.
+		if s.collectingRegions {
+			s.regionUnlocks = append(s.regionUnlocks, unlock)
+		} else {
+			defer unlock()
+		}
+
+		return copyStruct(s.encodeTo, s.encodeToHintedUnsafePointer, s.goPath, originalV, encodedV, true /* isEncode */)
+	}
+
+	return copyCommon(s.encodeTo, s.goPath, originalV, encodedV)
+}
+
+// Traverses the keys and values of the map to collect the pointer regions; see
+// collectPointerRegions.
+func (s *JSONEncoder) collectMapRegions(mapV reflect.Value) error {
+	iter := mapV.MapRange()
+	for iter.Next() {
+		if _, err := s.encode(ensureAddressable(iter.Key())); err != nil {
+			return fmt.Errorf("collectMapRegions(): %w", err)
+		}
+
+		s.goPath.push(mapKeyPath(iter.Key()))
+		_, err := s.encode(ensureAddressable(iter.Value()))
+		s.goPath.pop()
+		if err != nil {
+			return err
+		}
 	}
 
-	return copyCommon(s.encodeTo, originalV, encodedV)
+	return nil
 }
 
 // Encodes the original value for marhsaling to JSON.
@@ -227,7 +545,7 @@ func (s *JSONEncoder) encode(fromV reflect.Value) (reflect.Value, error) {
 		return zeroValue, nil
 	}
 
-	encodedT, err := encodedTypeFor(fromV.Type())
+	encodedT, err := encodedTypeFor(s.config.encoding, fromV.Type())
 	if err != nil {
 		return zeroValue, fmt.Errorf("encode(): %w", err)
 	}
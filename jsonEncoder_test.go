@@ -61,3 +61,72 @@ func TestJSONEncoder_SharedPointers(t *testing.T) {
 	// the underlying objects are different from the original values.
 	assert.NotSame(t, obj1.b, decoded1.b)
 }
+
+func TestJSONEncoder_PointerReferences_Reordered(t *testing.T) {
+	value := 42
+
+	type object struct {
+		a *int
+	}
+
+	var (
+		obj1 = object{a: &value}
+		obj2 = object{a: &value}
+	)
+
+	encoder := NewJSONEncoder(WithPointerReferences())
+
+	encoded1, err := encoder.Encode(obj1)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"value":{"a":{"pointer":1,"value":42}}}`, string(encoded1))
+
+	encoded2, err := encoder.Encode(obj2)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"value":{"a":{"pointer":1}}}`, string(encoded2))
+
+	// Decode the reference before the value.
+	decoder := NewJSONDecoder()
+
+	var decoded2 object
+	require.NoError(t, decoder.Decode(encoded2, &decoded2))
+	assert.Nil(t, decoded2.a)
+	assert.Equal(t, []string{"1"}, decoder.UnresolvedPointers())
+
+	var decoded1 object
+	require.NoError(t, decoder.Decode(encoded1, &decoded1))
+	assert.Empty(t, decoder.UnresolvedPointers())
+
+	assert.Equal(t, obj2, decoded2)
+	assert.Same(t, decoded1.a, decoded2.a)
+
+	// Unresolved reference numbers are sorted numerically.
+	values := make([]*int, 10)
+	for i := range values {
+		values[i] = ptrTo(i)
+	}
+
+	_, err = encoder.Encode(values)
+	require.NoError(t, err)
+
+	encoded3, err := encoder.Encode(values)
+	require.NoError(t, err)
+
+	var decoded3 []*int
+	decoder = NewJSONDecoder()
+	require.NoError(t, decoder.Decode(encoded3, &decoded3))
+	assert.Equal(t, []string{"2", "3", "4", "5", "6", "7", "8", "9", "10", "11"}, decoder.UnresolvedPointers())
+}
+
+// Tests that an encoder can be reused after Encode fails.
+func TestJSONEncoder_ReusedAfterError(t *testing.T) {
+	in := &placeholderFailing{fail: true}
+
+	encoder := NewJSONEncoder()
+	_, err := encoder.Encode(in)
+	require.Error(t, err)
+
+	in.fail = false
+	out, err := encoder.Encode(in)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"value": {"pointer": 1, "value": {"value": "ok"}}}`, string(out))
+}
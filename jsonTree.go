@@ -0,0 +1,213 @@
+package unsafely
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// The kind of a jsonNode.
+type jsonNodeKind int
+
+const (
+	jsonScalar jsonNodeKind = iota
+	jsonObject
+	jsonArray
+)
+
+// A parsed JSON value that preserves the order of object keys, so the JSON
+// can be modified and written out in the same order.
+type jsonNode struct {
+	kind jsonNodeKind
+
+	// The JSON representation of scalar values.
+	raw json.RawMessage
+
+	// Object keys and values.
+	keys   []string
+	values []*jsonNode
+
+	// Array elements.
+	elems []*jsonNode
+}
+
+// Returns the value for the key in an object, or nil if it is not present.
+func (node *jsonNode) get(key string) *jsonNode {
+	for i, k := range node.keys {
+		if k == key {
+			return node.values[i]
+		}
+	}
+	return nil
+}
+
+// Returns the fields of the JSON object, if the JSON is an object and isKey
+// returns true for each of its keys.
+//
+// This is used to check whether JSON looks like one of the objects used in the
+// encoding, e.g, a pointerValue. The object is scanned up to the first
+// unexpected key, rather than unmarshaling all of it.
+func objectFields(b []byte, isKey func(key string) bool) (map[string]json.RawMessage, bool) {
+	if b = bytes.TrimSpace(b); len(b) == 0 || b[0] != '{' {
+		return nil, false
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(b))
+	if _, err := dec.Token(); err != nil {
+		return nil, false
+	}
+
+	fields := make(map[string]json.RawMessage)
+	for dec.More() {
+		token, err := dec.Token()
+		key, isString := token.(string)
+		if err != nil || !isString || !isKey(key) {
+			return nil, false
+		}
+
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return nil, false
+		}
+		fields[key] = value
+	}
+
+	return fields, true
+}
+
+// Parses a JSON value.
+func parseJSONNode(b []byte) (*jsonNode, error) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+
+	node, err := parseJSONNodeFrom(dec)
+	if err != nil {
+		return nil, fmt.Errorf("parseJSONNode(): %w", err)
+	}
+
+	if _, err := dec.Token(); !errors.Is(err, io.EOF) {
+		return nil, errors.New("parseJSONNode(): unexpected data after JSON value")
+	}
+
+	return node, nil
+}
+
+func parseJSONNodeFrom(dec *json.Decoder) (*jsonNode, error) {
+	token, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch token := token.(type) {
+	case json.Delim:
+		switch token {
+		case '{':
+			node := &jsonNode{kind: jsonObject}
+			for dec.More() {
+				keyToken, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+
+				value, err := parseJSONNodeFrom(dec)
+				if err != nil {
+					return nil, err
+				}
+
+				node.keys = append(node.keys, keyToken.(string))
+				node.values = append(node.values, value)
+			}
+
+			_, err := dec.Token() // '}'
+			return node, err
+
+		case '[':
+			node := &jsonNode{kind: jsonArray}
+			for dec.More() {
+				elem, err := parseJSONNodeFrom(dec)
+				if err != nil {
+					return nil, err
+				}
+				node.elems = append(node.elems, elem)
+			}
+
+			_, err := dec.Token() // ']'
+			return node, err
+
+		default:
+			return nil, fmt.Errorf("unexpected delimiter %v", token)
+		}
+
+	case json.Number:
+		return &jsonNode{kind: jsonScalar, raw: json.RawMessage(token)}, nil
+
+	default: // string, bool or nil
+		raw, err := json.Marshal(token)
+		if err != nil {
+			return nil, err
+		}
+		return &jsonNode{kind: jsonScalar, raw: raw}, nil
+	}
+}
+
+// Writes the node as JSON, formatted the same way as JSONEncoder.Encode.
+func (node *jsonNode) format(prefix, indent string) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := node.writeTo(&buf); err != nil {
+		return nil, err
+	}
+
+	if prefix == "" && indent == "" {
+		return buf.Bytes(), nil
+	}
+
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, buf.Bytes(), prefix, indent); err != nil {
+		return nil, err
+	}
+	return indented.Bytes(), nil
+}
+
+// Writes the node as compact JSON.
+func (node *jsonNode) writeTo(buf *bytes.Buffer) error {
+	switch node.kind {
+	case jsonObject:
+		buf.WriteByte('{')
+		for i, key := range node.keys {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+
+			keyBytes, err := json.Marshal(key)
+			if err != nil {
+				return err
+			}
+			buf.Write(keyBytes)
+			buf.WriteByte(':')
+
+			if err := node.values[i].writeTo(buf); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+
+	case jsonArray:
+		buf.WriteByte('[')
+		for i, elem := range node.elems {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := elem.writeTo(buf); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+
+	default:
+		buf.Write(node.raw)
+	}
+
+	return nil
+}
@@ -0,0 +1,186 @@
+package unsafely
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"sync"
+	"time"
+	"unsafe"
+)
+
+// The default time to wait for a lock; see WithLockedSnapshots.
+const defaultLockTimeout = 5 * time.Second
+
+// The longest time to sleep between attempts to acquire a lock.
+const maxLockBackoff = time.Millisecond
+
+var (
+	mutexType   = reflect.TypeFor[sync.Mutex]()
+	rwMutexType = reflect.TypeFor[sync.RWMutex]()
+)
+
+// A lock that can be acquired without blocking, e.g, sync.Mutex.
+type tryLocker interface {
+	TryLock() bool
+	Unlock()
+}
+
+// A lock with a read lock that can be acquired without blocking, e.g,
+// sync.RWMutex.
+type tryRLocker interface {
+	TryRLock() bool
+	RUnlock()
+}
+
+// A lock in a struct that is held while the struct is encoded.
+type structLock struct {
+	addr unsafe.Pointer
+
+	// The name of the field, used in errors.
+	name string
+
+	tryLock func() bool
+	unlock  func()
+}
+
+// Acquires the locks that guard the struct, if using WithLockedSnapshots, and
+// returns a function that releases them.
+//
+// The locks are the struct's sync.Mutex and sync.RWMutex fields, and fields
+// tagged with `unsafely.guard:"true"`. Read locks are used where possible.
+func (s *JSONEncoder) lockStruct(structV reflect.Value) (func(), error) {
+	unlockAll := func() {}
+	if !s.config.lockedSnapshots || !structV.CanAddr() {
+		return unlockAll, nil
+	}
+
+	locks := structLocks(structV)
+	if len(locks) == 0 {
+		return unlockAll, nil
+	}
+
+	// Locks already held by the encoder, e.g, if a pointer refers back to a
+	// struct being encoded, are not acquired again.
+	locks = slices.DeleteFunc(locks, func(lock structLock) bool {
+		_, held := s.heldLocks[lock.addr]
+		return held
+	})
+
+	// Acquire the locks in a consistent order, so concurrent snapshots of the
+	// same struct don't deadlock each other.
+	slices.SortFunc(locks, func(a, b structLock) int {
+		return compareAddresses(a.addr, b.addr)
+	})
+
+	var acquired []structLock
+	unlockAll = func() {
+		for _, lock := range slices.Backward(acquired) {
+			lock.unlock()
+			delete(s.heldLocks, lock.addr)
+		}
+	}
+
+	timeout := s.config.lockTimeout
+	if timeout <= 0 {
+		timeout = defaultLockTimeout
+	}
+
+	for _, lock := range locks {
+		if !acquireLock(lock, timeout) {
+			unlockAll()
+			return nil, fmt.Errorf(
+				"lockStruct(): timed out after %v waiting for lock %s in %v", timeout, lock.name, structV.Type(),
+			)
+		}
+
+		acquired = append(acquired, lock)
+		s.heldLocks[lock.addr] = struct{}{}
+	}
+
+	return unlockAll, nil
+}
+
+// Returns the locks that guard the addressable struct.
+func structLocks(structV reflect.Value) []structLock {
+	var (
+		structT = structV.Type()
+		locks   []structLock
+	)
+
+	for i := range structT.NumField() {
+		field := structT.Field(i)
+		if field.Type != mutexType && field.Type != rwMutexType && field.Tag.Get("unsafely.guard") != "true" {
+			continue
+		}
+
+		// The lock may be a value, or a pointer or interface referring to one.
+		lockV := getField(structV.Field(i))
+		if lockV.Kind() == reflect.Interface || lockV.Kind() == reflect.Pointer {
+			if lockV.IsNil() {
+				continue
+			}
+		} else {
+			lockV = lockV.Addr()
+		}
+
+		lock := structLock{name: field.Name}
+		switch l := lockV.Interface().(type) {
+		case tryRLocker:
+			lock.tryLock, lock.unlock = l.TryRLock, l.RUnlock
+		case tryLocker:
+			lock.tryLock, lock.unlock = l.TryLock, l.Unlock
+		default:
+			continue
+		}
+
+		if lockV.Kind() == reflect.Interface {
+			lockV = lockV.Elem()
+		}
+		if lockV.Kind() != reflect.Pointer {
+			continue
+		}
+		lock.addr = lockV.UnsafePointer()
+
+		locks = append(locks, lock)
+	}
+
+	return locks
+}
+
+// Tries to acquire the lock until the timeout, backing off between attempts.
+func acquireLock(lock structLock, timeout time.Duration) bool {
+	var (
+		deadline = time.Now().Add(timeout)
+		backoff  = time.Microsecond
+	)
+
+	for !lock.tryLock() {
+		if time.Now().After(deadline) {
+			return false
+		}
+
+		time.Sleep(backoff)
+		backoff = min(2*backoff, maxLockBackoff)
+	}
+
+	return true
+}
+
+// Returns true if the lock at the address is held by the encoder; see
+// WithLockedSnapshots.
+func (s *JSONEncoder) holdsLock(addr unsafe.Pointer) bool {
+	_, held := s.heldLocks[addr]
+	return held
+}
+
+func compareAddresses(a, b unsafe.Pointer) int {
+	switch {
+	case uintptr(a) < uintptr(b):
+		return -1
+	case uintptr(a) > uintptr(b):
+		return 1
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,147 @@
+package unsafely
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// A key and value in a map.
+type mapEntry struct {
+	key, value reflect.Value
+
+	// Used to order the map entries.
+	sortKey string
+}
+
+// Returns the entries of the map in a deterministic order.
+//
+// Entries are sorted by their encoded keys, which matches the order of the
+// keys in the JSON output for primitive keys. Non-primitive keys (e.g, structs,
+// pointers) are sorted by their encoding with a new JSONEncoder, so the order
+// doesn't depend on pointers that were encoded earlier. If these are the same,
+// e.g, for pointers to equal values, the entries are sorted by their values in
+// the same way.
+//
+// Keys and values are first compared by their shallow sort keys, and only
+// entries that are still tied are compared by their full encodings; see
+// sortKeyFor. Entries that are the same in every encoding, e.g, pointers to
+// equal values, are finally ordered by their Go values, including addresses.
+func (s *JSONEncoder) sortedMapEntries(mapV reflect.Value) ([]mapEntry, error) {
+	entries := make([]mapEntry, 0, mapV.Len())
+
+	iter := mapV.MapRange()
+	for iter.Next() {
+		entries = append(entries, mapEntry{key: iter.Key(), value: iter.Value()})
+	}
+
+	sortKeyFuncs := []func(entry mapEntry) (string, error){
+		func(entry mapEntry) (string, error) { return s.sortKeyFor(entry.key, false) },
+		func(entry mapEntry) (string, error) { return s.sortKeyFor(entry.key, true) },
+		func(entry mapEntry) (string, error) { return s.sortKeyFor(entry.value, false) },
+		func(entry mapEntry) (string, error) { return s.sortKeyFor(entry.value, true) },
+		func(entry mapEntry) (string, error) { return fmt.Sprintf("%#v", entry.key), nil },
+	}
+
+	// Each sort key only orders the groups of entries that are tied on the
+	// previous sort keys.
+	groups := [][]mapEntry{entries}
+	for _, sortKeyFunc := range sortKeyFuncs {
+		var tied [][]mapEntry
+		for _, group := range groups {
+			for i := range group {
+				var err error
+				group[i].sortKey, err = sortKeyFunc(group[i])
+				if err != nil {
+					return nil, fmt.Errorf("sortedMapEntries(): %w", err)
+				}
+			}
+
+			slices.SortStableFunc(group, func(a, b mapEntry) int {
+				return strings.Compare(a.sortKey, b.sortKey)
+			})
+
+			for start := 0; start < len(group); {
+				end := start + 1
+				for end < len(group) && group[end].sortKey == group[start].sortKey {
+					end++
+				}
+
+				if end-start > 1 {
+					tied = append(tied, group[start:end])
+				}
+				start = end
+			}
+		}
+
+		if groups = tied; len(groups) == 0 {
+			break
+		}
+	}
+
+	return entries, nil
+}
+
+// Returns a string used to sort map keys and values.
+//
+// Values other than primitives are encoded with a new encoder, so the order
+// doesn't depend on pointers that were encoded earlier. Shallow sort keys
+// don't include the values of nested pointers and maps, so these are cheap to
+// compute even for pointers into large graphs, and are cached for pointers.
+// Deep sort keys include the whole value, and are used to break ties.
+func (s *JSONEncoder) sortKeyFor(v reflect.Value, deep bool) (string, error) {
+	if isTextMapKey(s.config.encoding, v.Type()) {
+		return marshalTextKey(v)
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'g', -1, 64), nil
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), nil
+	}
+
+	var (
+		isCached = !deep && v.Kind() == reflect.Pointer && !v.IsNil()
+		key      pointerKey
+	)
+	if isCached {
+		key = pointerKey{ptr: v.UnsafePointer(), elemT: v.Type().Elem()}
+		if sortKey, ok := s.sortKeys[key]; ok {
+			return sortKey, nil
+		}
+	}
+
+	// Shallow sort keys don't refer back to the pointers that are being
+	// encoded, so these don't depend on where the map is.
+	encoder := s.newDryRunEncoder(newPointerRegions())
+	if !deep {
+		encoder.shallow = true
+		encoder.pendingPointers = make(map[pointerKey]struct{})
+	}
+
+	encodedV, err := encoder.encode(ensureAddressable(v))
+	if err != nil {
+		return "", err
+	}
+
+	b, err := json.Marshal(encodedV.Interface())
+	if err != nil {
+		return "", err
+	}
+
+	if isCached {
+		s.sortKeys[key] = string(b)
+	}
+
+	return string(b), nil
+}
@@ -2,17 +2,56 @@ package unsafely
 
 import (
 	"encoding/json"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/outriggerlabs/unsafely/typeutil"
 )
 
-// Wrapper that we're using to reserve an extra layer around the value. We may
-// need to use this later to embed configuration options for unmarshaling.
+// Wrapper that we're using to reserve an extra layer around the value. This
+// also embeds configuration options required for unmarshaling.
 //
 // Also, the extra layer discourages attempts to use this as a drop-in for
 // standard JSON marshaling.
 type encodedJSONWrapper struct {
+	// Options that affect the encoded representation; omitted if these are the
+	// defaults.
+	Options *encodingOptions `json:"options,omitempty"`
+
 	Value json.RawMessage `json:"value"`
 }
 
+// Options that change the encoded representation of values. These are stored
+// with the encoded value, so the same options are used when decoding.
+//
+// This is used as a cache key for encoded types, so it must be comparable.
+type encodingOptions struct {
+	// If set, slices are encoded as references to their backing arrays.
+	SliceAliasing bool `json:"sliceAliasing,omitempty"`
+
+	// If set, the fields of embedded structs are promoted to the containing
+	// struct, like encoding/json.
+	FlattenEmbedded bool `json:"flattenEmbedded,omitempty"`
+
+	// If set, unsafe pointers are encoded as references to other pointers.
+	UnsafePointers bool `json:"unsafePointers,omitempty"`
+
+	// If set, unsupported values are encoded as placeholders.
+	Placeholders bool `json:"placeholders,omitempty"`
+
+	// A sorted, comma-separated list of the packages and types whose custom
+	// marshalers are ignored, or "*" for all types; see WithoutCustomMarshalers.
+	IgnoreMarshalers string `json:"ignoreMarshalers,omitempty"`
+
+	// If set, the bits of NaN floats are encoded; see WithNaNPayloads.
+	NaNPayloads bool `json:"nanPayloads,omitempty"`
+
+	// If set, bytes and strings are encoded for readability; see
+	// WithReadableOutput.
+	Readable bool `json:"readable,omitempty"`
+}
+
 // MarshalJSON serializes the value to a JSON string, including unexported
 // fields.
 //
@@ -25,6 +64,26 @@ func MarshalJSON(in any, options ...MarshalJSONOption) ([]byte, error) {
 type marshalJSONConfig struct {
 	prefix string
 	indent string
+
+	pointerReferences bool
+	pointerIDs        PointerIDs
+	inlinePointers    bool
+
+	// Resolves the type hints of unsafe pointers; see WithUnsafePointers.
+	unsafePointerResolver typeutil.Resolver
+
+	// Sentinel errors that are encoded by name; see WithSentinelErrors.
+	sentinelErrors SentinelErrors
+
+	// Instances that are encoded by name; see WithWellKnown.
+	wellKnown WellKnownInstances
+
+	// If set, structs are encoded while holding their locks; see
+	// WithLockedSnapshots.
+	lockedSnapshots bool
+	lockTimeout     time.Duration
+
+	encoding encodingOptions
 }
 
 // MarshalJSONOption is an option for modifying the behavior of MarshalJSON.
@@ -43,3 +102,211 @@ func WithIndent(indent string) MarshalJSONOption {
 		config.indent = indent
 	}
 }
+
+// WithPointerReferences only includes the underlying value of a pointer the
+// first time it is encoded. Later occurrences of the pointer, including those
+// in later calls to JSONEncoder.Encode, only contain the reference number.
+//
+// This avoids repeating large values that are shared by many pointers. The
+// JSONDecoder resolves references that appear before the pointer value, e.g,
+// if the output of multiple Encode calls is decoded in a different order.
+func WithPointerReferences() MarshalJSONOption {
+	return func(config *marshalJSONConfig) {
+		config.pointerReferences = true
+	}
+}
+
+// WithSliceAliasing encodes slices as references to their backing arrays,
+// including the length and capacity of the slice.
+//
+// Slices that share a backing array, e.g, buf and buf[2:5], will also share
+// a backing array when unmarshaled. Pointers to slice elements point into the
+// unmarshaled backing array.
+//
+// Note: Slices that partially overlap, without either containing the other, do
+// not share a backing array when unmarshaled, unless another slice covering
+// both of them is also encoded.
+func WithSliceAliasing() MarshalJSONOption {
+	return func(config *marshalJSONConfig) {
+		config.encoding.SliceAliasing = true
+	}
+}
+
+// WithFlattenedEmbeddedFields promotes the fields of embedded structs to the
+// containing struct, following the same rules as encoding/json. By default,
+// embedded fields are nested under the name of their type.
+//
+// Note: Embedded pointers, and embedded structs with custom encodings (e.g,
+// json.Marshaler), are still nested. As with encoding/json, promoted fields
+// that conflict with other fields at the same depth are not encoded.
+func WithFlattenedEmbeddedFields() MarshalJSONOption {
+	return func(config *marshalJSONConfig) {
+		config.encoding.FlattenEmbedded = true
+	}
+}
+
+// WithUnsafePointers encodes unsafe.Pointer values as references to the values
+// of other pointers in the encoded data, including pointers into those values.
+// Unsafe pointers to values that are not otherwise encoded are replaced by an
+// opaque marker, and are nil when unmarshaled.
+//
+// The type of the value referenced by an unsafe.Pointer field can be given in
+// an "unsafely.elem" tag, e.g, `unsafely.elem:"example.com/pkg.Node"`. These
+// fields are encoded like pointers to that type, so the value is encoded even
+// if it is not otherwise referenced. The resolver is used to resolve the type
+// by its package path and name, or type string if there is no package path. The
+// same type must be resolvable when unmarshaling; see WithTypeResolver.
+//
+// The resolver may be nil if there are no type hints.
+func WithUnsafePointers(resolver typeutil.Resolver) MarshalJSONOption {
+	return func(config *marshalJSONConfig) {
+		config.encoding.UnsafePointers = true
+		config.unsafePointerResolver = resolver
+	}
+}
+
+// WithPlaceholders encodes values of unsupported types as Placeholder objects,
+// which describe the value, rather than returning an error. Values that fail
+// to encode are also replaced by placeholders, i.e, values whose custom
+// marshalers return errors, and functions without symbol names. The
+// placeholders are available from JSONEncoder.Placeholders.
+//
+// When unmarshaling, placeholders result in an error, unless
+// WithPlaceholdersAsZero is set.
+func WithPlaceholders() MarshalJSONOption {
+	return func(config *marshalJSONConfig) {
+		config.encoding.Placeholders = true
+	}
+}
+
+// WithPointerIDs sets how pointer IDs are assigned; see PointerIDs.
+//
+// By default, pointers are numbered after their underlying values are encoded,
+// so adding a value can change the numbers for all other pointers. Using
+// PathPointerIDs avoids this, which is useful for comparing "golden" outputs.
+func WithPointerIDs(mode PointerIDs) MarshalJSONOption {
+	return func(config *marshalJSONConfig) {
+		config.pointerIDs = mode
+	}
+}
+
+// WithInlinePointers encodes pointers that are only referenced once as their
+// underlying values, e.g, 42 rather than {"pointer":1,"value":42}. Pointers
+// that are shared, or that other pointers point into, are encoded as usual.
+//
+// Note: Pointers are only considered shared if they are referenced more than
+// once in the same call to JSONEncoder.Encode. If a pointer is inlined and then
+// referenced in a later call, the unmarshaled values won't share the pointer.
+func WithInlinePointers() MarshalJSONOption {
+	return func(config *marshalJSONConfig) {
+		config.inlinePointers = true
+	}
+}
+
+// WithLockedSnapshots acquires the locks that guard each struct while the
+// struct is encoded, so values that are used concurrently are encoded
+// consistently. The locks of a struct are its sync.Mutex and sync.RWMutex
+// fields (read locks are used for sync.RWMutex), and any fields tagged with
+// `unsafely.guard:"true"` that refer to a lock with a TryLock or TryRLock
+// method, e.g, a *sync.Mutex.
+//
+// The locks of a struct are acquired in address order, and locks that are
+// already held by the encoder are not acquired again. If a lock can't be
+// acquired within the timeout (or 5 seconds, if the timeout is not positive),
+// marshaling fails rather than hanging.
+//
+// Locks are encoded in the state they were in before the encoder acquired
+// them. Values must be passed by pointer, since a copy of a struct does not
+// share its locks.
+//
+// If the value may contain pointers, it is traversed once before it is
+// encoded, to find the memory referenced by pointers. The locks acquired while
+// traversing are held until the value is encoded, so locks of different
+// structs may be held at the same time. Structs used as map keys may be locked
+// again to sort the keys.
+func WithLockedSnapshots(timeout time.Duration) MarshalJSONOption {
+	return func(config *marshalJSONConfig) {
+		config.lockedSnapshots = true
+		config.lockTimeout = timeout
+	}
+}
+
+// WithSentinelErrors encodes the sentinel errors by their names, in addition
+// to the sentinel errors in the standard library; see SentinelErrors. Use
+// WithSentinelErrorResolver with the same SentinelErrors when unmarshaling.
+//
+// Other errors are encoded with their concrete values, messages and the errors
+// that they wrap. These are unmarshaled as their concrete types if the types
+// can be resolved (see WithTypeResolver), and as UnmarshaledError otherwise.
+func WithSentinelErrors(sentinels SentinelErrors) MarshalJSONOption {
+	return func(config *marshalJSONConfig) {
+		config.sentinelErrors = sentinels
+	}
+}
+
+// WithWellKnown encodes pointers, channels and interface values that refer to
+// the well-known instances by their names; see WellKnownInstances. Use
+// WithWellKnownResolver with the same WellKnownInstances when unmarshaling.
+func WithWellKnown(instances WellKnownInstances) MarshalJSONOption {
+	return func(config *marshalJSONConfig) {
+		config.wellKnown = instances
+	}
+}
+
+// WithoutCustomMarshalers ignores the custom marshalers of types (e.g,
+// json.Marshaler or encoding.TextMarshaler), so their fields are encoded
+// instead, like types without marshalers. This is useful for inspecting state
+// that the marshalers don't expose.
+//
+// If any packages or types are given, only the marshalers of the types in these
+// are ignored. Packages are given by path, e.g, "example.com/pkg", and types by
+// package path and name, e.g, "example.com/pkg.Type". Otherwise, all custom
+// marshalers are ignored.
+//
+// The ignored marshalers are recorded in the output, so the unmarshaled values
+// are decoded from their fields, rather than using their unmarshalers.
+func WithoutCustomMarshalers(packagesOrTypes ...string) MarshalJSONOption {
+	return func(config *marshalJSONConfig) {
+		if len(packagesOrTypes) == 0 {
+			config.encoding.IgnoreMarshalers = "*"
+			return
+		}
+
+		ignored := slices.Clone(packagesOrTypes)
+		if config.encoding.IgnoreMarshalers != "" {
+			ignored = append(ignored, strings.Split(config.encoding.IgnoreMarshalers, ",")...)
+		}
+
+		slices.Sort(ignored)
+		config.encoding.IgnoreMarshalers = strings.Join(slices.Compact(ignored), ",")
+	}
+}
+
+// WithNaNPayloads encodes the bits of NaN floats, so the unmarshaled floats
+// have the same payloads, e.g, {"float":"NaN","bits":"0x7ff8000000000001"}. By
+// default, NaN floats are encoded as {"float":"NaN"}, and unmarshaled as
+// math.NaN().
+//
+// Note: The parts of complex64 values are converted to float64, which may set
+// the quiet bit of signaling NaNs.
+func WithNaNPayloads() MarshalJSONOption {
+	return func(config *marshalJSONConfig) {
+		config.encoding.NaNPayloads = true
+	}
+}
+
+// WithReadableOutput encodes values in a form that is easier to review, e.g,
+// in golden files:
+//   - Byte slices and arrays are encoded as {"text":"..."} if they are
+//     printable text, or {"hex":"..."} otherwise, rather than base64 strings
+//     and arrays of numbers.
+//   - Strings with multiple lines are encoded as arrays of lines.
+//   - <, > and & are not escaped.
+//
+// The option is recorded in the output, so these forms are unmarshaled back
+// to the original values.
+func WithReadableOutput() MarshalJSONOption {
+	return func(config *marshalJSONConfig) {
+		config.encoding.Readable = true
+	}
+}
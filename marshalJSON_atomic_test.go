@@ -0,0 +1,90 @@
+package unsafely
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type atomicCounter atomic.Int64
+
+type atomicMetrics struct {
+	hits    atomic.Int32
+	bytes   atomic.Uint64
+	healthy atomic.Bool
+	last    atomic.Pointer[string]
+	sizes   [2]atomic.Uint32
+	total   atomicCounter
+}
+
+// Tests that atomic fields are read atomically while they are updated
+// concurrently. This is only meaningful with the race detector.
+func TestMarshalJSON_Atomic_Concurrent(t *testing.T) {
+	var (
+		in   = &atomicMetrics{}
+		stop = make(chan struct{})
+		wg   sync.WaitGroup
+	)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		last := "request"
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+
+			in.hits.Add(1)
+			in.bytes.Add(100)
+			in.healthy.Store(!in.healthy.Load())
+			in.last.Store(&last)
+			in.sizes[1].Add(1)
+			(*atomic.Int64)(&in.total).Add(1)
+		}
+	}()
+
+	for range 10 {
+		out, err := MarshalJSON(in)
+		require.NoError(t, err)
+
+		var decoded *atomicMetrics
+		require.NoError(t, UnmarshalJSON(out, &decoded))
+	}
+
+	close(stop)
+	wg.Wait()
+}
+
+// Tests that types defined as atomic types are encoded by their values.
+func TestMarshalJSON_Atomic_DefinedTypes(t *testing.T) {
+	in := &atomicMetrics{}
+	(*atomic.Int64)(&in.total).Store(42)
+
+	out, err := MarshalJSON(in)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"value": {
+			"pointer": 2,
+			"value": {
+				"hits": 0,
+				"bytes": 0,
+				"healthy": false,
+				"last": {"pointer": 1, "value": null},
+				"sizes": [0, 0],
+				"total": 42
+			}
+		}
+	}`, string(out))
+
+	var decoded *atomicMetrics
+	require.NoError(t, UnmarshalJSON(out, &decoded))
+	require.NotNil(t, decoded)
+	assert.Equal(t, int64(42), (*atomic.Int64)(&decoded.total).Load())
+}
@@ -0,0 +1,117 @@
+package unsafely
+
+import (
+	"testing"
+	"unsafe"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Tests that channels are encoded with their buffered elements and closed
+// state, without receiving from them.
+func TestMarshalJSON_Chan(t *testing.T) {
+	type chanExample struct {
+		queue   chan int
+		done    chan struct{}
+		recvx   <-chan string
+		nilChan chan int
+	}
+
+	queue := make(chan int, 4)
+
+	// Advance the receive index, so the buffer wraps around.
+	queue <- 0
+	queue <- 0
+	<-queue
+	<-queue
+	for i := 1; i <= 4; i++ {
+		queue <- i
+	}
+
+	done := make(chan struct{})
+	close(done)
+
+	strs := make(chan string, 2)
+	strs <- "a"
+	close(strs)
+
+	in := chanExample{queue: queue, done: done, recvx: strs}
+
+	out, err := MarshalJSON(in)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"value": {
+			"queue": {"pointer": 1, "value": {"cap": 4, "buffer": [1, 2, 3, 4]}},
+			"done": {"pointer": 2, "value": {"cap": 0, "closed": true, "buffer": []}},
+			"recvx": {"pointer": 3, "value": {"cap": 2, "closed": true, "buffer": ["a"]}},
+			"nilChan": {"pointer": 4, "value": null}
+		}
+	}`, string(out))
+
+	// The channel is unchanged.
+	assert.Equal(t, 4, len(queue))
+	assert.Equal(t, 1, <-queue)
+
+	var decoded chanExample
+	require.NoError(t, UnmarshalJSON(out, &decoded))
+	assert.Nil(t, decoded.nilChan)
+	assert.Equal(t, 4, cap(decoded.queue))
+	assert.Equal(t, []int{1, 2, 3, 4}, []int{<-decoded.queue, <-decoded.queue, <-decoded.queue, <-decoded.queue})
+
+	_, ok := <-decoded.done
+	assert.False(t, ok)
+
+	s, ok := <-decoded.recvx
+	assert.True(t, ok)
+	assert.Equal(t, "a", s)
+
+	_, ok = <-decoded.recvx
+	assert.False(t, ok)
+}
+
+// Tests that shared channels are decoded as the same channel, including
+// channels with different directions.
+func TestMarshalJSON_Chan_Shared(t *testing.T) {
+	type chanNode struct {
+		name string
+		ch   chan *chanNode
+	}
+
+	type chanShared struct {
+		send chan<- *chanNode
+		recv <-chan *chanNode
+		node *chanNode
+	}
+
+	// The channel contains a node that refers to the channel.
+	ch := make(chan *chanNode, 1)
+	node := &chanNode{name: "node", ch: ch}
+	ch <- node
+
+	in := chanShared{send: ch, recv: ch, node: node}
+
+	out, err := MarshalJSON(in, WithPointerReferences())
+	require.NoError(t, err)
+
+	var decoded chanShared
+	require.NoError(t, UnmarshalJSON(out, &decoded))
+	require.NotNil(t, decoded.node)
+
+	assert.Same(t, decoded.node, <-decoded.recv)
+
+	decoded.send <- nil
+	assert.Nil(t, <-decoded.node.ch)
+}
+
+// Tests that channels with unsupported element types are rejected.
+func TestMarshalJSON_Chan_UnsupportedElem(t *testing.T) {
+	_, err := MarshalJSON(make(chan unsafe.Pointer))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unsupported kind")
+}
+
+// Tests that hchanHeader matches the layout of channels in this runtime.
+func TestMarshalJSON_Chan_Layout(t *testing.T) {
+	require.NoError(t, checkHchanLayout())
+}
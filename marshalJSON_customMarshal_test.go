@@ -1,9 +1,15 @@
 package unsafely
 
 import (
+	"encoding/binary"
 	"encoding/json"
+	"fmt"
+	"net"
 	"strings"
 	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // Tests that custom marshaling and unmarshaling is supported, and that we can
@@ -40,3 +46,235 @@ func (s customJSON) MarshalJSON() ([]byte, error) {
 	marshalled := [2]string{s.value, strings.ToUpper(s.value)}
 	return json.Marshal(marshalled)
 }
+
+// Tests that marshalers with pointer receivers, unmarshaler-only types, text
+// marshalers and binary marshalers are used, including for map keys.
+func TestMarshalJSON_CustomMarshal_Interfaces(t *testing.T) {
+	type marshalers struct {
+		ptrJSON    ptrCustomJSON
+		ptrJSONPtr *ptrCustomJSON
+		unmarshal  unmarshalOnlyJSON
+		level      textLevel
+		levels     map[textLevel]string
+		ip         net.IP
+		point      binaryPoint
+	}
+
+	in := marshalers{
+		ptrJSON:    ptrCustomJSON{value: "value"},
+		ptrJSONPtr: &ptrCustomJSON{value: "pointer"},
+		unmarshal:  unmarshalOnlyJSON{Name: "name", length: 4},
+		level:      levelWarn,
+		levels:     map[textLevel]string{levelDebug: "debug", levelWarn: "warn"},
+		ip:         net.ParseIP("192.0.2.1"),
+		point:      binaryPoint{x: 1, y: 2},
+	}
+
+	out, err := MarshalJSON(in)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"value": {
+			"ptrJSON": "value",
+			"ptrJSONPtr": {"pointer": 1, "value": "pointer"},
+			"unmarshal": {"Name": "name"},
+			"level": "warn",
+			"levels": {"debug": "debug", "warn": "warn"},
+			"ip": "192.0.2.1",
+			"point": "AAAAAQAAAAI="
+		}
+	}`, string(out))
+
+	var decoded marshalers
+	require.NoError(t, UnmarshalJSON(out, &decoded))
+	assert.Equal(t, in, decoded)
+
+	testMarshalJSON(t, map[string]any{
+		"ptrCustomJSON":     ptrCustomJSON{value: "value"},
+		"unmarshalOnlyJSON": unmarshalOnlyJSON{Name: "name", length: 4},
+		"textLevel":         levelWarn,
+		"binaryPoint":       binaryPoint{x: -1, y: 1},
+	})
+}
+
+// A json.Marshaler and json.Unmarshaler with pointer receivers.
+type ptrCustomJSON struct {
+	value string
+}
+
+func (s *ptrCustomJSON) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.value)
+}
+
+func (s *ptrCustomJSON) UnmarshalJSON(b []byte) error {
+	return json.Unmarshal(b, &s.value)
+}
+
+// A json.Unmarshaler without a MarshalJSON method, which computes an
+// unexported field.
+type unmarshalOnlyJSON struct {
+	Name   string
+	length int
+}
+
+func (s *unmarshalOnlyJSON) UnmarshalJSON(b []byte) error {
+	var fields struct{ Name string }
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return err
+	}
+
+	*s = unmarshalOnlyJSON{Name: fields.Name, length: len(fields.Name)}
+	return nil
+}
+
+// An enum with text marshalers.
+type textLevel int
+
+const (
+	levelDebug textLevel = iota
+	levelWarn
+)
+
+func (l textLevel) MarshalText() ([]byte, error) {
+	switch l {
+	case levelDebug:
+		return []byte("debug"), nil
+	case levelWarn:
+		return []byte("warn"), nil
+	}
+	return nil, fmt.Errorf("invalid level %d", int(l))
+}
+
+func (l *textLevel) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "debug":
+		*l = levelDebug
+	case "warn":
+		*l = levelWarn
+	default:
+		return fmt.Errorf("invalid level %q", text)
+	}
+	return nil
+}
+
+// A type with binary marshalers.
+type binaryPoint struct {
+	x, y int32
+}
+
+func (p binaryPoint) MarshalBinary() ([]byte, error) {
+	return binary.BigEndian.AppendUint32(binary.BigEndian.AppendUint32(nil, uint32(p.x)), uint32(p.y)), nil
+}
+
+func (p *binaryPoint) UnmarshalBinary(b []byte) error {
+	if len(b) != 8 {
+		return fmt.Errorf("invalid point of length %d", len(b))
+	}
+
+	p.x = int32(binary.BigEndian.Uint32(b))
+	p.y = int32(binary.BigEndian.Uint32(b[4:]))
+	return nil
+}
+
+// Tests that custom marshalers can be ignored, for all types or for specific
+// types, and that decoding mirrors the choice.
+func TestMarshalJSON_CustomMarshal_Ignored(t *testing.T) {
+	type ignoredMarshalers struct {
+		custom  customJSON
+		ptrJSON ptrCustomJSON
+		levels  map[textLevel]int
+	}
+
+	in := ignoredMarshalers{
+		custom:  customJSON{value: "custom"},
+		ptrJSON: ptrCustomJSON{value: "value"},
+		levels:  map[textLevel]int{levelWarn: 1},
+	}
+
+	out, err := MarshalJSON(in, WithoutCustomMarshalers())
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"options": {"ignoreMarshalers": "*"},
+		"value": {
+			"custom": {"value": "custom", "unsupported": null},
+			"ptrJSON": {"value": "value"},
+			"levels": {"1": 1}
+		}
+	}`, string(out))
+
+	var decoded ignoredMarshalers
+	require.NoError(t, UnmarshalJSON(out, &decoded))
+	assert.Equal(t, in, decoded)
+
+	out, err = MarshalJSON(in, WithoutCustomMarshalers(
+		"github.com/outriggerlabs/unsafely.ptrCustomJSON",
+		"github.com/outriggerlabs/unsafely.customJSON",
+	))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"options": {
+			"ignoreMarshalers": "github.com/outriggerlabs/unsafely.customJSON,github.com/outriggerlabs/unsafely.ptrCustomJSON"
+		},
+		"value": {
+			"custom": {"value": "custom", "unsupported": null},
+			"ptrJSON": {"value": "value"},
+			"levels": {"warn": 1}
+		}
+	}`, string(out))
+
+	decoded = ignoredMarshalers{}
+	require.NoError(t, UnmarshalJSON(out, &decoded))
+	assert.Equal(t, in, decoded)
+}
+
+// A string type with text marshalers that returns the string as-is.
+type rawText string
+
+func (s rawText) MarshalText() ([]byte, error) {
+	return []byte(s), nil
+}
+
+func (s *rawText) UnmarshalText(text []byte) error {
+	*s = rawText(text)
+	return nil
+}
+
+// Tests that map keys with text marshalers are escaped like string keys, so
+// text that is not valid UTF-8 is restored.
+func TestMarshalJSON_CustomMarshal_TextKeys(t *testing.T) {
+	in := map[rawText]int{"ok": 1, "\xfe": 2, "\x00null": 3}
+
+	out, err := MarshalJSON(in)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"value": {"ok": 1, "\u0000\\xfe": 2, "\u0000\u0000null": 3}}`, string(out))
+
+	var decoded map[rawText]int
+	require.NoError(t, UnmarshalJSON(out, &decoded))
+	assert.Equal(t, in, decoded)
+}
+
+// A marshaler that counts how many times it is called.
+type countingMarshaler struct {
+	calls *int
+}
+
+func (m countingMarshaler) MarshalJSON() ([]byte, error) {
+	*m.calls++
+	return []byte(`"counted"`), nil
+}
+
+// Tests that custom marshalers are only called once per value, even if the
+// value contains pointers.
+func TestMarshalJSON_CustomMarshal_CalledOnce(t *testing.T) {
+	type withPointer struct {
+		Marshaler countingMarshaler
+		Pointer   *int
+	}
+
+	var calls int
+	in := withPointer{Marshaler: countingMarshaler{calls: &calls}, Pointer: new(int)}
+
+	out, err := MarshalJSON(in)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"value": {"Marshaler": "counted", "Pointer": {"pointer": 1, "value": 0}}}`, string(out))
+	assert.Equal(t, 1, calls)
+}
@@ -1,13 +1,16 @@
 package unsafely
 
 import (
+	"container/ring"
+	"strings"
 	"testing"
 
+	"github.com/outriggerlabs/unsafely/typeutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
-// Tests that recursive structures are supported, but cyclic data is not.
+// Tests that recursive structures and cyclic data are supported.
 func TestMarshalJSON_DetectCycles(t *testing.T) {
 	type node struct {
 		next *node
@@ -21,8 +24,49 @@ func TestMarshalJSON_DetectCycles(t *testing.T) {
 		)
 		c.next = a
 
-		_, err := MarshalJSON(a)
-		require.ErrorContains(t, err, "cycle detected")
+		out, err := MarshalJSON(a, WithIndent("  "))
+		require.NoError(t, err)
+		assert.JSONEq(t, `
+{
+  "value": {
+		"pointer": 1,
+		"value": {
+			"next": {
+				"pointer": 3,
+				"value": {
+					"next": {
+						"pointer": 2,
+						"value": {
+							"next": {
+								"pointer": 1
+							}
+						}
+					}
+				}
+			}
+		}
+  }
+}`,
+			string(out))
+
+		var decoded *node
+		require.NoError(t, UnmarshalJSON(out, &decoded))
+		assert.Same(t, decoded, decoded.next.next.next)
+		assert.NotSame(t, decoded, decoded.next)
+		assert.NotSame(t, decoded, decoded.next.next)
+	})
+
+	t.Run("self", func(t *testing.T) {
+		a := &node{}
+		a.next = a
+
+		out, err := MarshalJSON(a)
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"value":{"pointer":1,"value":{"next":{"pointer":1}}}}`, string(out))
+
+		var decoded *node
+		require.NoError(t, UnmarshalJSON(out, &decoded))
+		assert.Same(t, decoded, decoded.next)
 	})
 
 	t.Run("linear", func(t *testing.T) {
@@ -62,3 +106,69 @@ func TestMarshalJSON_DetectCycles(t *testing.T) {
 		assert.Equal(t, a, decoded)
 	})
 }
+
+func TestMarshalJSON_Cycles_DoublyLinked(t *testing.T) {
+	type node struct {
+		value      int
+		prev, next *node
+	}
+
+	var (
+		a = &node{value: 1}
+		b = &node{value: 2, prev: a}
+		c = &node{value: 3, prev: b}
+	)
+	a.next, b.next = b, c
+
+	out, err := MarshalJSON(a)
+	require.NoError(t, err)
+
+	var decoded *node
+	require.NoError(t, UnmarshalJSON(out, &decoded))
+
+	require.NotNil(t, decoded.next)
+	require.NotNil(t, decoded.next.next)
+	assert.Equal(t, []int{1, 2, 3}, []int{decoded.value, decoded.next.value, decoded.next.next.value})
+	assert.Same(t, decoded, decoded.next.prev)
+	assert.Same(t, decoded.next, decoded.next.next.prev)
+	assert.Nil(t, decoded.prev)
+	assert.Nil(t, decoded.next.next.next)
+}
+
+func TestMarshalJSON_Cycles_Ring(t *testing.T) {
+	r := ring.New(3)
+	for i := range 3 {
+		r.Value = i
+		r = r.Next()
+	}
+
+	out, err := MarshalJSON(r)
+	require.NoError(t, err)
+
+	var decoded *ring.Ring
+	require.NoError(t, UnmarshalJSON(out, &decoded, WithTypeResolver(typeutil.UnsafeResolver())))
+
+	var values []any
+	decoded.Do(func(v any) {
+		values = append(values, v)
+	})
+	assert.Equal(t, []any{0, 1, 2}, values)
+	assert.Same(t, decoded, decoded.Next().Next().Next())
+	assert.Same(t, decoded, decoded.Prev().Next())
+}
+
+// strings.Builder contains a pointer to itself to detect copies.
+func TestMarshalJSON_Cycles_StringsBuilder(t *testing.T) {
+	b := &strings.Builder{}
+	b.WriteString("hello")
+
+	out, err := MarshalJSON(b)
+	require.NoError(t, err)
+
+	var decoded *strings.Builder
+	require.NoError(t, UnmarshalJSON(out, &decoded))
+
+	// The builder would panic on a write if the self-pointer was incorrect.
+	decoded.WriteString(", world")
+	assert.Equal(t, "hello, world", decoded.String())
+}
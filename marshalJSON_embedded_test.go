@@ -0,0 +1,142 @@
+package unsafely
+
+import (
+	"encoding/json"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type embeddedCounter int
+
+func (c embeddedCounter) String() string {
+	return strconv.Itoa(int(c))
+}
+
+type embeddedInner struct {
+	X, Y int
+}
+
+// Tests that embedded fields are nested under their type names by default.
+func TestMarshalJSON_EmbeddedFields(t *testing.T) {
+	type embeddedOuter struct {
+		sync.Mutex
+		embeddedCounter
+		*embeddedInner
+		name string
+	}
+
+	in := &embeddedOuter{
+		embeddedCounter: 3,
+		embeddedInner:   &embeddedInner{X: 1, Y: 2},
+		name:            "outer",
+	}
+
+	out, err := MarshalJSON(in)
+	require.NoError(t, err)
+
+	var wrapper struct {
+		Value struct {
+			Value map[string]json.RawMessage `json:"value"`
+		} `json:"value"`
+	}
+	require.NoError(t, json.Unmarshal(out, &wrapper))
+
+	fields := wrapper.Value.Value
+	assert.Contains(t, fields, "Mutex")
+	assert.JSONEq(t, `3`, string(fields["embeddedCounter"]))
+	assert.JSONEq(t, `{"pointer": 1, "value": {"X": 1, "Y": 2}}`, string(fields["embeddedInner"]))
+	assert.JSONEq(t, `"outer"`, string(fields["name"]))
+
+	var decoded *embeddedOuter
+	require.NoError(t, UnmarshalJSON(out, &decoded))
+	assert.Equal(t, in.embeddedCounter, decoded.embeddedCounter)
+	assert.Equal(t, in.embeddedInner, decoded.embeddedInner)
+	assert.Equal(t, in.name, decoded.name)
+}
+
+// Tests that the fields of embedded structs are promoted with
+// WithFlattenedEmbeddedFields.
+func TestMarshalJSON_FlattenedEmbeddedFields(t *testing.T) {
+	type embeddedTagged struct {
+		Z int
+	}
+
+	type embeddedFlat struct {
+		embeddedInner
+		embeddedTagged `json:"tagged"`
+		*embeddedCounterHolder
+		W int
+	}
+
+	in := embeddedFlat{
+		embeddedInner:         embeddedInner{X: 1, Y: 2},
+		embeddedTagged:        embeddedTagged{Z: 3},
+		embeddedCounterHolder: nil,
+		W:                     4,
+	}
+
+	out, err := MarshalJSON(in, WithFlattenedEmbeddedFields())
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"options": {"flattenEmbedded": true},
+		"value": {
+			"X": 1,
+			"Y": 2,
+			"tagged": {"Z": 3},
+			"embeddedCounterHolder": {"pointer": 1, "value": null},
+			"W": 4
+		}
+	}`, string(out))
+
+	var decoded embeddedFlat
+	require.NoError(t, UnmarshalJSON(out, &decoded))
+	assert.Equal(t, in, decoded)
+}
+
+type embeddedCounterHolder struct {
+	Count int
+}
+
+// Tests that conflicting promoted fields follow the encoding/json rules.
+func TestMarshalJSON_FlattenedEmbeddedFields_Conflicts(t *testing.T) {
+	type embeddedA struct {
+		X int
+		Y int
+		Z int `json:"Z"`
+	}
+
+	type embeddedB struct {
+		X int
+		Z int
+	}
+
+	type embeddedConflicts struct {
+		embeddedA
+		embeddedB
+		Y string
+	}
+
+	in := embeddedConflicts{
+		embeddedA: embeddedA{X: 1, Y: 2, Z: 3},
+		embeddedB: embeddedB{X: 4, Z: 5},
+		Y:         "outer",
+	}
+
+	out, err := MarshalJSON(in, WithFlattenedEmbeddedFields())
+	require.NoError(t, err)
+
+	// X is ambiguous, so it is dropped. The outer Y is shallower, and the
+	// tagged Z in embeddedA is dominant.
+	assert.JSONEq(t, `{
+		"options": {"flattenEmbedded": true},
+		"value": {"Z": 3, "Y": "outer"}
+	}`, string(out))
+
+	var decoded embeddedConflicts
+	require.NoError(t, UnmarshalJSON(out, &decoded))
+	assert.Equal(t, embeddedConflicts{embeddedA: embeddedA{Z: 3}, Y: "outer"}, decoded)
+}
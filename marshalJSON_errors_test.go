@@ -0,0 +1,204 @@
+package unsafely
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"testing"
+
+	"github.com/outriggerlabs/unsafely/typeutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errTestNotFound = errors.New("not found")
+
+type errorsExample struct {
+	eof      error
+	wrapped  error
+	joined   error
+	custom   error
+	pathErr  *fs.PathError
+	nilError error
+}
+
+// Tests that errors are encoded with their concrete values, messages and
+// chains, that sentinel errors are decoded as the same errors, and that errors
+// whose types can't be resolved are decoded as UnmarshaledError.
+func TestMarshalJSON_Errors(t *testing.T) {
+	in := errorsExample{
+		eof:     io.EOF,
+		wrapped: fmt.Errorf("lookup: %w", errTestNotFound),
+		joined:  errors.Join(errors.New("first"), io.ErrUnexpectedEOF),
+		custom:  errTestNotFound,
+		pathErr: &fs.PathError{Op: "open", Path: "/missing", Err: fs.ErrNotExist},
+	}
+
+	sentinels := NewSentinelErrors().Add("unsafely.errTestNotFound", errTestNotFound)
+
+	out, err := MarshalJSON(in, WithSentinelErrors(sentinels))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"value": {
+			"eof": {"sentinel": "io.EOF", "message": "EOF"},
+			"wrapped": {
+				"ptrDepth": 1,
+				"pkgPath": "fmt",
+				"typeName": "wrapError",
+				"value": {
+					"pointer": 1,
+					"value": {
+						"msg": "lookup: not found",
+						"err": {"sentinel": "unsafely.errTestNotFound", "message": "not found"}
+					}
+				},
+				"message": "lookup: not found",
+				"wrapped": [{"sentinel": "unsafely.errTestNotFound", "message": "not found"}]
+			},
+			"joined": {
+				"ptrDepth": 1,
+				"pkgPath": "errors",
+				"typeName": "joinError",
+				"value": {
+					"pointer": 3,
+					"value": {
+						"errs": [
+							{
+								"ptrDepth": 1,
+								"pkgPath": "errors",
+								"typeName": "errorString",
+								"value": {"pointer": 2, "value": {"s": "first"}},
+								"message": "first"
+							},
+							{"sentinel": "io.ErrUnexpectedEOF", "message": "unexpected EOF"}
+						]
+					}
+				},
+				"message": "first\nunexpected EOF",
+				"wrapped": [
+					{"ptrDepth": 1, "pkgPath": "errors", "typeName": "errorString", "message": "first"},
+					{"sentinel": "io.ErrUnexpectedEOF", "message": "unexpected EOF"}
+				]
+			},
+			"custom": {"sentinel": "unsafely.errTestNotFound", "message": "not found"},
+			"pathErr": {
+				"pointer": 4,
+				"value": {
+					"Op": "open",
+					"Path": "/missing",
+					"Err": {"sentinel": "io/fs.ErrNotExist", "message": "file does not exist"}
+				}
+			},
+			"nilError": null
+		}
+	}`, string(out))
+
+	var decoded errorsExample
+	require.NoError(t, UnmarshalJSON(out, &decoded, WithSentinelErrorResolver(sentinels)))
+
+	assert.Same(t, io.EOF, decoded.eof)
+	assert.Same(t, errTestNotFound, decoded.custom)
+	assert.Nil(t, decoded.nilError)
+
+	assert.EqualError(t, decoded.wrapped, "lookup: not found")
+	assert.ErrorIs(t, decoded.wrapped, errTestNotFound)
+
+	var unmarshaled *UnmarshaledError
+	require.ErrorAs(t, decoded.wrapped, &unmarshaled)
+	assert.Equal(t, "*fmt.wrapError", unmarshaled.Type)
+
+	assert.EqualError(t, decoded.joined, "first\nunexpected EOF")
+	assert.ErrorIs(t, decoded.joined, io.ErrUnexpectedEOF)
+
+	assert.ErrorIs(t, decoded.pathErr, fs.ErrNotExist)
+}
+
+type codeError struct {
+	Code int
+}
+
+func (e *codeError) Error() string {
+	return fmt.Sprintf("code %d", e.Code)
+}
+
+// Tests that errors are decoded as their concrete types if the types can be
+// resolved.
+func TestMarshalJSON_Errors_ConcreteTypes(t *testing.T) {
+	type errorField struct {
+		Err     error
+		Wrapped error
+	}
+
+	in := errorField{
+		Err:     &codeError{Code: 5},
+		Wrapped: fmt.Errorf("lookup: %w", &codeError{Code: 6}),
+	}
+
+	out, err := MarshalJSON(in)
+	require.NoError(t, err)
+
+	var decoded errorField
+	require.NoError(t, UnmarshalJSON(out, &decoded, WithTypeResolver(typeutil.UnsafeResolver())))
+	assert.Equal(t, in, decoded)
+
+	var codeErr *codeError
+	require.ErrorAs(t, decoded.Wrapped, &codeErr)
+	assert.Equal(t, 6, codeErr.Code)
+
+	// Without a type resolver, the errors are decoded as UnmarshaledError.
+	require.NoError(t, UnmarshalJSON(out, &decoded))
+
+	var unmarshaled *UnmarshaledError
+	require.ErrorAs(t, decoded.Err, &unmarshaled)
+	assert.Equal(t, "*github.com/outriggerlabs/unsafely.codeError", unmarshaled.Type)
+	assert.EqualError(t, decoded.Err, "code 5")
+}
+
+// Tests that unknown sentinel errors are rejected.
+func TestMarshalJSON_Errors_UnknownSentinel(t *testing.T) {
+	type errorField struct {
+		err error
+	}
+
+	sentinels := NewSentinelErrors().Add("unsafely.errTestNotFound", errTestNotFound)
+
+	out, err := MarshalJSON(errorField{err: errTestNotFound}, WithSentinelErrors(sentinels))
+	require.NoError(t, err)
+
+	var decoded errorField
+	err = UnmarshalJSON(out, &decoded)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown sentinel error unsafely.errTestNotFound")
+}
+
+type errorWithDetails struct {
+	details any
+}
+
+func (e errorWithDetails) Error() string {
+	return fmt.Sprint(e.details)
+}
+
+// Tests that errors holding uncomparable values in interface fields are
+// encoded as other errors.
+func TestMarshalJSON_Errors_Uncomparable(t *testing.T) {
+	type errorField struct {
+		err error
+	}
+
+	in := errorField{err: errorWithDetails{details: []string{"a"}}}
+
+	out, err := MarshalJSON(in)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"value": {
+			"err": {
+				"pkgPath": "github.com/outriggerlabs/unsafely",
+				"typeName": "errorWithDetails",
+				"value": {"details": {"typeString": "[]string", "value": ["a"]}},
+				"message": "[a]"
+			}
+		}
+	}`, string(out))
+}
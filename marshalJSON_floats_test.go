@@ -0,0 +1,146 @@
+package unsafely
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Tests that NaN, infinite and negative zero floats are encoded in a tagged
+// form, including in complex numbers and map keys, and restored exactly.
+func TestMarshalJSON_Floats(t *testing.T) {
+	type floats struct {
+		nan     float64
+		posInf  float32
+		negZero float64
+		finite  float32
+		slice   []float64
+		values  map[string]float32
+		keys    map[float64]string
+		complex complex128
+	}
+
+	in := floats{
+		nan:     math.NaN(),
+		posInf:  float32(math.Inf(1)),
+		negZero: math.Copysign(0, -1),
+		finite:  1.1,
+		slice:   []float64{math.Inf(-1), 0, 2.5},
+		values:  map[string]float32{"nan": float32(math.NaN())},
+		keys:    map[float64]string{math.Inf(1): "inf", 1.5: "finite", math.NaN(): "nan"},
+		complex: complex(math.NaN(), math.Copysign(0, -1)),
+	}
+
+	out, err := MarshalJSON(in)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"value": {
+			"nan": {"float": "NaN"},
+			"posInf": {"float": "+Inf"},
+			"negZero": {"float": "-0"},
+			"finite": 1.1,
+			"slice": [{"float": "-Inf"}, 0, 2.5],
+			"values": {"nan": {"float": "NaN"}},
+			"keys": {
+				"1.5": "finite",
+				"{\"float\":\"+Inf\"}": "inf",
+				"{\"float\":\"NaN\"}": "nan"
+			},
+			"complex": {"real": {"float": "NaN"}, "imag": {"float": "-0"}}
+		}
+	}`, string(out))
+
+	var decoded floats
+	require.NoError(t, UnmarshalJSON(out, &decoded))
+
+	assert.True(t, math.IsNaN(decoded.nan))
+	assert.True(t, math.IsInf(float64(decoded.posInf), 1))
+	assert.Equal(t, math.Float64bits(in.negZero), math.Float64bits(decoded.negZero))
+	assert.Equal(t, in.finite, decoded.finite)
+	assert.Equal(t, in.slice, decoded.slice)
+	assert.True(t, math.IsNaN(float64(decoded.values["nan"])))
+	assert.True(t, math.IsNaN(real(decoded.complex)))
+	assert.True(t, math.Signbit(imag(decoded.complex)))
+
+	assert.Len(t, decoded.keys, 3)
+	for k, v := range decoded.keys {
+		switch {
+		case math.IsNaN(k):
+			assert.Equal(t, "nan", v)
+		default:
+			assert.Equal(t, in.keys[k], v)
+		}
+	}
+}
+
+// Tests that the payloads of NaN floats are kept using WithNaNPayloads.
+func TestMarshalJSON_Floats_NaNPayloads(t *testing.T) {
+	type payloads struct {
+		nan64   float64
+		nan32   float32
+		complex complex128
+	}
+
+	in := payloads{
+		nan64:   math.Float64frombits(0x7ff8000000000123),
+		nan32:   math.Float32frombits(0xffc00042),
+		complex: complex(math.Float64frombits(0x7ff8000000000456), 1),
+	}
+
+	out, err := MarshalJSON(in, WithNaNPayloads())
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"options": {"nanPayloads": true},
+		"value": {
+			"nan64": {"float": "NaN", "bits": "0x7ff8000000000123"},
+			"nan32": {"float": "NaN", "bits": "0xffc00042"},
+			"complex": {
+				"real": {"float": "NaN", "bits": "0x7ff8000000000456"},
+				"imag": 1
+			}
+		}
+	}`, string(out))
+
+	var decoded payloads
+	require.NoError(t, UnmarshalJSON(out, &decoded))
+	assert.Equal(t, uint64(0x7ff8000000000123), math.Float64bits(decoded.nan64))
+	assert.Equal(t, uint32(0xffc00042), math.Float32bits(decoded.nan32))
+	assert.Equal(t, uint64(0x7ff8000000000456), math.Float64bits(real(decoded.complex)))
+	assert.Equal(t, 1.0, imag(decoded.complex))
+}
+
+// Tests that maps with multiple NaN keys keep all of their entries.
+func TestMarshalJSON_Floats_DuplicateNaNKeys(t *testing.T) {
+	in := map[float64]int{math.NaN(): 1, math.NaN(): 2, 1: 3}
+
+	out, err := MarshalJSON(in)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"value": {
+		"1": 3,
+		"{\"float\":\"NaN\"}": 1,
+		"{\"float\":\"NaN\",\"key\":2}": 2
+	}}`, string(out))
+
+	var decoded map[float64]int
+	require.NoError(t, UnmarshalJSON(out, &decoded))
+	require.Len(t, decoded, 3)
+
+	var nanValues []int
+	for k, v := range decoded {
+		if math.IsNaN(k) {
+			nanValues = append(nanValues, v)
+		}
+	}
+	assert.ElementsMatch(t, []int{1, 2}, nanValues)
+}
+
+// Tests that other map keys that are encoded the same, e.g, structs with NaN
+// fields, result in an error rather than dropping entries.
+func TestMarshalJSON_Floats_DuplicateStructKeys(t *testing.T) {
+	type key struct{ f float64 }
+
+	_, err := MarshalJSON(map[key]int{{math.NaN()}: 1, {math.NaN()}: 2})
+	assert.ErrorContains(t, err, "duplicate encoded map key")
+}
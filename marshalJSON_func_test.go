@@ -0,0 +1,125 @@
+package unsafely
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/outriggerlabs/unsafely/typeutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type funcStrategy struct {
+	prefix string
+}
+
+func (s *funcStrategy) Apply(in string) string {
+	return s.prefix + in
+}
+
+// Tests that top-level functions and method expressions are restored using a
+// function resolver.
+func TestMarshalJSON_Func(t *testing.T) {
+	type funcExample struct {
+		transform func(string) string
+		apply     func(*funcStrategy, string) string
+		handler   http.HandlerFunc
+		onDone    func()
+	}
+
+	in := funcExample{
+		transform: strings.ToUpper,
+		apply:     (*funcStrategy).Apply,
+		handler:   http.NotFound,
+	}
+
+	out, err := MarshalJSON(in)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"value": {
+			"transform": {"name": "strings.ToUpper"},
+			"apply": {"name": "github.com/outriggerlabs/unsafely.(*funcStrategy).Apply"},
+			"handler": {"name": "net/http.NotFound"},
+			"onDone": null
+		}
+	}`, string(out))
+
+	resolver := typeutil.NewStaticFuncResolver().AddFuncs(strings.ToUpper, (*funcStrategy).Apply, http.NotFound)
+
+	var decoded funcExample
+	require.NoError(t, UnmarshalJSON(out, &decoded, WithFuncResolver(resolver)))
+	assert.Equal(t, "ABC", decoded.transform("abc"))
+	assert.Equal(t, "> abc", decoded.apply(&funcStrategy{prefix: "> "}, "abc"))
+	assert.NotNil(t, decoded.handler)
+	assert.Nil(t, decoded.onDone)
+}
+
+// Tests that closures are flagged, and that unresolved functions either fail
+// or are replaced by placeholders.
+func TestMarshalJSON_Func_Unresolved(t *testing.T) {
+	type funcCallback struct {
+		callback func() int
+	}
+
+	n := 1
+	in := funcCallback{callback: func() int { return n }}
+
+	out, err := MarshalJSON(in)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"value": {
+			"callback": {"name": "github.com/outriggerlabs/unsafely.TestMarshalJSON_Func_Unresolved.func1", "closure": true}
+		}
+	}`, string(out))
+
+	var decoded funcCallback
+	err = UnmarshalJSON(out, &decoded, WithFuncResolver(typeutil.NewStaticFuncResolver()))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "is a closure or method value")
+
+	err = UnmarshalJSON(out, &decoded, WithClosureResolution())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "WithFuncResolver")
+
+	err = UnmarshalJSON(out, &decoded, WithFuncResolver(typeutil.NewStaticFuncResolver()), WithClosureResolution())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "could not find function")
+
+	require.NoError(t, UnmarshalJSON(out, &decoded, WithFuncPlaceholders()))
+	require.NotNil(t, decoded.callback)
+	assert.PanicsWithValue(t,
+		"unsafely: called placeholder for unresolved function "+
+			"github.com/outriggerlabs/unsafely.TestMarshalJSON_Func_Unresolved.func1",
+		func() { decoded.callback() },
+	)
+}
+
+// Tests that closures and method values are only resolved by name with
+// WithClosureResolution.
+func TestMarshalJSON_Func_Closures(t *testing.T) {
+	type funcMethodValue struct {
+		apply func(string) string
+	}
+
+	strategy := &funcStrategy{prefix: "> "}
+	in := funcMethodValue{apply: strategy.Apply}
+
+	out, err := MarshalJSON(in)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"value": {
+			"apply": {"name": "github.com/outriggerlabs/unsafely.(*funcStrategy).Apply-fm", "closure": true}
+		}
+	}`, string(out))
+
+	resolver := typeutil.NewStaticFuncResolver().AddFuncs(in.apply)
+
+	var decoded funcMethodValue
+	err = UnmarshalJSON(out, &decoded, WithFuncResolver(resolver))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "is a closure or method value")
+
+	require.NoError(t, UnmarshalJSON(out, &decoded, WithFuncResolver(resolver), WithClosureResolution()))
+	assert.NotNil(t, decoded.apply)
+}
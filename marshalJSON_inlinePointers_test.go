@@ -0,0 +1,158 @@
+package unsafely
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Tests that only shared pointers are annotated with WithInlinePointers.
+func TestMarshalJSON_InlinePointers(t *testing.T) {
+	type inlineShared struct {
+		name string
+	}
+
+	type inlineExample struct {
+		unshared *int
+		nilPtr   *int
+		first    *inlineShared
+		second   *inlineShared
+		nested   **int
+		nilElem  **int
+	}
+
+	s := &inlineShared{name: "shared"}
+	in := inlineExample{
+		unshared: ptrTo(1),
+		first:    s,
+		second:   s,
+		nested:   ptrTo(ptrTo(2)),
+		nilElem:  new(*int),
+	}
+
+	out, err := MarshalJSON(in, WithPointerReferences(), WithInlinePointers())
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"value": {
+			"unshared": 1,
+			"nilPtr": null,
+			"first": {"pointer": 1, "value": {"name": "shared"}},
+			"second": {"pointer": 1},
+			"nested": 2,
+			"nilElem": {"pointer": 3, "value": {"pointer": 2, "value": null}}
+		}
+	}`, string(out))
+
+	var decoded inlineExample
+	require.NoError(t, UnmarshalJSON(out, &decoded))
+	assert.Equal(t, in, decoded)
+	assert.Same(t, decoded.first, decoded.second)
+}
+
+// Tests that references are counted for each call to Encode, so a reused
+// encoder inlines the same pointers each time.
+func TestMarshalJSON_InlinePointers_ReusedEncoder(t *testing.T) {
+	type inlineExample struct {
+		value *int
+	}
+
+	in := inlineExample{value: ptrTo(5)}
+
+	encoder := NewJSONEncoder(WithInlinePointers())
+	for range 2 {
+		out, err := encoder.Encode(in)
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"value": {"value": 5}}`, string(out))
+	}
+}
+
+// Tests that pointers to values that look like pointerValues are annotated.
+func TestMarshalJSON_InlinePointers_Ambiguous(t *testing.T) {
+	type inlineLookalike struct {
+		Pointer int    `json:"pointer"`
+		Value   string `json:"value"`
+	}
+
+	type inlineLookalikes struct {
+		lookalike *inlineLookalike
+		other     *struct{ Pointer string }
+	}
+
+	in := inlineLookalikes{
+		lookalike: &inlineLookalike{Pointer: 1, Value: "a"},
+		other:     &struct{ Pointer string }{Pointer: "b"},
+	}
+
+	out, err := MarshalJSON(in, WithInlinePointers())
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"value": {
+			"lookalike": {"pointer": 1, "value": {"pointer": 1, "value": "a"}},
+			"other": {"Pointer": "b"}
+		}
+	}`, string(out))
+
+	var decoded inlineLookalikes
+	require.NoError(t, UnmarshalJSON(out, &decoded))
+	assert.Equal(t, in, decoded)
+}
+
+// Tests that cycles and interior pointers are annotated.
+func TestMarshalJSON_InlinePointers_CyclesAndInteriorPointers(t *testing.T) {
+	type inlineNode struct {
+		next  *inlineNode
+		value int
+	}
+
+	type inlineGraph struct {
+		head  *inlineNode
+		value *int
+	}
+
+	head := &inlineNode{value: 1}
+	head.next = &inlineNode{value: 2, next: head}
+	in := inlineGraph{head: head, value: &head.next.value}
+
+	out, err := MarshalJSON(in, WithPointerReferences(), WithInlinePointers())
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"value": {
+			"head": {"pointer": 1, "value": {"next": {"pointer": 2, "value": {"next": {"pointer": 1}, "value": 2}}, "value": 1}},
+			"value": {"pointer": 2, "path": "/value"}
+		}
+	}`, string(out))
+
+	var decoded inlineGraph
+	require.NoError(t, UnmarshalJSON(out, &decoded))
+	assert.Same(t, decoded.head, decoded.head.next.next)
+	assert.Same(t, &decoded.head.next.value, decoded.value)
+}
+
+// Tests that slices sharing a backing array are annotated, and that other
+// backing arrays are inlined.
+func TestMarshalJSON_InlinePointers_SliceAliasing(t *testing.T) {
+	type inlineSlices struct {
+		a, b  []int
+		other []int
+	}
+
+	array := []int{1, 2, 3}
+	in := inlineSlices{a: array, b: array[1:], other: []int{4}}
+
+	out, err := MarshalJSON(in, WithSliceAliasing(), WithInlinePointers())
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"options": {"sliceAliasing": true},
+		"value": {
+			"a": {"len": 3, "cap": 3, "array": {"pointer": 1, "value": [1, 2, 3]}},
+			"b": {"len": 2, "cap": 2, "array": {"pointer": 1, "path": "/1"}},
+			"other": {"len": 1, "cap": 1, "array": [4]}
+		}
+	}`, string(out))
+
+	var decoded inlineSlices
+	require.NoError(t, UnmarshalJSON(out, &decoded))
+	assert.Equal(t, in, decoded)
+	assert.Same(t, &decoded.a[1], &decoded.b[0])
+}
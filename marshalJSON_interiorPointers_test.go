@@ -0,0 +1,138 @@
+package unsafely
+
+import (
+	"container/list"
+	"testing"
+
+	"github.com/outriggerlabs/unsafely/typeutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Tests that pointers into struct fields and array elements refer to the
+// containing value.
+func TestMarshalJSON_InteriorPointers(t *testing.T) {
+	type inner struct {
+		values [3]int
+	}
+
+	type container struct {
+		first int
+		inner inner
+	}
+
+	type example struct {
+		// The interior pointers are encoded before the container.
+		first   *int
+		element *int
+		inner   *inner
+		outer   *container
+	}
+
+	c := &container{first: 1, inner: inner{values: [3]int{2, 3, 4}}}
+	in := example{
+		first:   &c.first,
+		element: &c.inner.values[1],
+		inner:   &c.inner,
+		outer:   c,
+	}
+
+	out, err := MarshalJSON(in)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"value": {
+			"first": {"pointer": 1, "path": "/first"},
+			"element": {"pointer": 1, "path": "/inner/values/1"},
+			"inner": {"pointer": 1, "path": "/inner"},
+			"outer": {"pointer": 1, "value": {"first": 1, "inner": {"values": [2, 3, 4]}}}
+		}
+	}`, string(out))
+
+	var decoded example
+	require.NoError(t, UnmarshalJSON(out, &decoded))
+	assert.Equal(t, in, decoded)
+	assert.Same(t, &decoded.outer.first, decoded.first)
+	assert.Same(t, &decoded.outer.inner.values[1], decoded.element)
+	assert.Same(t, &decoded.outer.inner, decoded.inner)
+}
+
+// A pointer to a struct and a pointer to its first field have the same
+// address, but are different pointers.
+func TestMarshalJSON_InteriorPointers_SameAddress(t *testing.T) {
+	type container struct {
+		first int
+	}
+
+	type example struct {
+		outer *container
+		first *int
+	}
+
+	c := &container{first: 1}
+	in := example{outer: c, first: &c.first}
+
+	out, err := MarshalJSON(in)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"value": {
+			"outer": {"pointer": 1, "value": {"first": 1}},
+			"first": {"pointer": 1, "path": "/first"}
+		}
+	}`, string(out))
+
+	var decoded example
+	require.NoError(t, UnmarshalJSON(out, &decoded))
+	assert.Same(t, &decoded.outer.first, decoded.first)
+}
+
+// Pointers to zero-sized values may share the same address, so they should
+// not be treated as the same pointer.
+func TestMarshalJSON_InteriorPointers_ZeroSized(t *testing.T) {
+	type example struct {
+		empty *struct{}
+		array *[0]int
+	}
+
+	in := example{empty: &struct{}{}, array: &[0]int{}}
+
+	out, err := MarshalJSON(in)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"value": {
+			"empty": {"pointer": 1, "value": {}},
+			"array": {"pointer": 2, "value": []}
+		}
+	}`, string(out))
+
+	var decoded example
+	require.NoError(t, UnmarshalJSON(out, &decoded))
+	assert.Equal(t, in, decoded)
+}
+
+// The elements in a container/list.List point to the root element, which is
+// a field in the List.
+func TestMarshalJSON_InteriorPointers_List(t *testing.T) {
+	l := list.New()
+	for i := range 3 {
+		l.PushBack(i)
+	}
+
+	out, err := MarshalJSON(l)
+	require.NoError(t, err)
+
+	var decoded *list.List
+	require.NoError(t, UnmarshalJSON(out, &decoded, WithTypeResolver(typeutil.UnsafeResolver())))
+	require.Equal(t, 3, decoded.Len())
+
+	var values []any
+	for e := decoded.Front(); e != nil; e = e.Next() {
+		values = append(values, e.Value)
+	}
+	assert.Equal(t, []any{0, 1, 2}, values)
+
+	// The decoded list can be modified.
+	decoded.PushFront(-1)
+	decoded.Remove(decoded.Back())
+	assert.Equal(t, -1, decoded.Front().Value)
+	assert.Equal(t, 1, decoded.Back().Value)
+}
@@ -0,0 +1,154 @@
+package unsafely
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type lockedCounter struct {
+	mu    sync.Mutex
+	count int
+	self  *lockedCounter
+}
+
+// Tests that structs are encoded while holding their locks, and that the locks
+// are encoded in their prior states.
+func TestMarshalJSON_LockedSnapshots(t *testing.T) {
+	in := &lockedCounter{count: 1}
+	in.self = in
+
+	in.mu.Lock()
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		in.count = 2
+		in.mu.Unlock()
+	}()
+
+	// The struct refers to itself, so its lock is only acquired once.
+	out, err := MarshalJSON(in, WithLockedSnapshots(time.Second))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"value": {
+			"pointer": 1,
+			"value": {"mu": {"locked": false}, "count": 2, "self": {"pointer": 1}}
+		}
+	}`, string(out))
+
+	// The lock is released afterwards.
+	assert.True(t, in.mu.TryLock())
+}
+
+// Tests that marshaling fails if a lock can't be acquired.
+func TestMarshalJSON_LockedSnapshots_Timeout(t *testing.T) {
+	in := &lockedCounter{}
+	in.mu.Lock()
+
+	_, err := MarshalJSON(in, WithLockedSnapshots(10*time.Millisecond))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "timed out after 10ms waiting for lock mu")
+}
+
+// Tests that read locks are used for sync.RWMutex, and that fields tagged as
+// guards are locked.
+func TestMarshalJSON_LockedSnapshots_Guards(t *testing.T) {
+	type guarded struct {
+		rw     sync.RWMutex
+		shared *sync.Mutex `unsafely.guard:"true"`
+		value  string
+	}
+
+	shared := &sync.Mutex{}
+	in := &guarded{shared: shared, value: "value"}
+	in.rw.RLock()
+	defer in.rw.RUnlock()
+
+	out, err := MarshalJSON(in, WithLockedSnapshots(time.Second))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"value": {
+			"pointer": 2,
+			"value": {
+				"rw": {"locked": false, "readers": 1},
+				"shared": {"pointer": 1, "value": {"locked": false}},
+				"value": "value"
+			}
+		}
+	}`, string(out))
+
+	shared.Lock()
+	defer shared.Unlock()
+
+	_, err = MarshalJSON(in, WithLockedSnapshots(10*time.Millisecond))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "waiting for lock shared")
+}
+
+type lockedNode struct {
+	mu       sync.Mutex
+	name     string
+	parent   *lockedNode
+	children map[*lockedNode]bool
+}
+
+// Tests that the locks held by the encoder are not acquired again when
+// encoding map keys to sort them.
+func TestMarshalJSON_LockedSnapshots_MapKeys(t *testing.T) {
+	root := &lockedNode{name: "root", children: make(map[*lockedNode]bool)}
+	for _, name := range []string{"a", "b"} {
+		root.children[&lockedNode{name: name, parent: root}] = true
+	}
+
+	out, err := MarshalJSON(root, WithLockedSnapshots(100*time.Millisecond))
+	require.NoError(t, err)
+
+	var decoded *lockedNode
+	require.NoError(t, UnmarshalJSON(out, &decoded))
+	require.Len(t, decoded.children, 2)
+	for child := range decoded.children {
+		assert.Same(t, decoded, child.parent)
+	}
+
+	// The locks are released afterwards.
+	assert.True(t, root.mu.TryLock())
+}
+
+// A lock that counts how many times it is acquired.
+type countingLock struct {
+	mu       sync.Mutex
+	acquired int
+}
+
+func (l *countingLock) TryLock() bool {
+	if !l.mu.TryLock() {
+		return false
+	}
+	l.acquired++
+	return true
+}
+
+func (l *countingLock) Unlock() {
+	l.mu.Unlock()
+}
+
+// Tests that the locks acquired while finding the memory referenced by
+// pointers are held until the value is encoded, rather than acquired again.
+func TestMarshalJSON_LockedSnapshots_AcquiredOnce(t *testing.T) {
+	type guarded struct {
+		lock  *countingLock `unsafely.guard:"true"`
+		value *string
+	}
+
+	value := "value"
+	in := &guarded{lock: &countingLock{}, value: &value}
+
+	_, err := MarshalJSON(in, WithLockedSnapshots(time.Second))
+	require.NoError(t, err)
+	assert.Equal(t, 1, in.lock.acquired)
+
+	// The lock is released afterwards.
+	assert.True(t, in.lock.TryLock())
+}
@@ -94,3 +94,109 @@ func testMapWithPointerKey[K *T, T comparable, V any](t *testing.T, input map[K]
 
 	assert.Equal(t, convert(input), convert(inputCopy))
 }
+
+// Tests that maps are encoded in a deterministic order, so pointers are
+// numbered consistently.
+func TestMarshalJSON_MapsDeterministicOrder(t *testing.T) {
+	type value struct {
+		name string
+	}
+
+	type example struct {
+		byName  map[string]*value
+		byPoint map[point]*value
+		byPtr   map[*point]*value
+	}
+
+	in := example{
+		byName:  make(map[string]*value),
+		byPoint: make(map[point]*value),
+		byPtr:   make(map[*point]*value),
+	}
+	for i := range 20 {
+		name := string(rune('a' + i))
+		in.byName[name] = &value{name: name}
+		in.byPoint[point{i, -i}] = &value{name: name}
+		in.byPtr[&point{-i, i}] = &value{name: name}
+	}
+
+	// Pointers to equal keys are ordered by their values.
+	in.byPtr[&point{-1, 1}] = &value{name: "duplicate"}
+
+	expected, err := MarshalJSON(in)
+	require.NoError(t, err)
+
+	for range 10 {
+		out, err := MarshalJSON(in)
+		require.NoError(t, err)
+		require.Equal(t, string(expected), string(out))
+	}
+
+	// Pointers are numbered in the order of the (sorted) keys.
+	out, err := MarshalJSON(map[string]*int{"b": ptrTo(2), "a": ptrTo(1), "c": ptrTo(3)})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"value":{
+		"a": {"pointer": 1, "value": 1},
+		"b": {"pointer": 2, "value": 2},
+		"c": {"pointer": 3, "value": 3}
+	}}`, string(out))
+}
+
+type mapTreeNode struct {
+	name     string
+	parent   *mapTreeNode
+	children map[*mapTreeNode]bool
+}
+
+// Tests that map keys that refer back to the values being encoded are sorted.
+func TestMarshalJSON_MapsWithCyclicKeys(t *testing.T) {
+	root := &mapTreeNode{name: "root", children: make(map[*mapTreeNode]bool)}
+	for _, name := range []string{"a", "b"} {
+		root.children[&mapTreeNode{name: name, parent: root}] = true
+	}
+
+	out, err := MarshalJSON(root)
+	require.NoError(t, err)
+
+	// The order doesn't depend on the iteration order of the map.
+	for range 10 {
+		again, err := MarshalJSON(root)
+		require.NoError(t, err)
+		assert.Equal(t, string(out), string(again))
+	}
+
+	var decoded *mapTreeNode
+	require.NoError(t, UnmarshalJSON(out, &decoded))
+	require.Len(t, decoded.children, 2)
+	for child := range decoded.children {
+		assert.Same(t, decoded, child.parent)
+	}
+}
+
+// Tests that maps with keys that point into a large graph are sorted without
+// encoding the graph for each key.
+func TestMarshalJSON_MapsWithGraphKeys(t *testing.T) {
+	type graphNode struct {
+		id   int
+		next *graphNode
+	}
+
+	var (
+		nodes = make(map[*graphNode]int)
+		head  *graphNode
+	)
+	for i := range 1000 {
+		head = &graphNode{id: i, next: head}
+		nodes[head] = i
+	}
+
+	out, err := MarshalJSON(nodes, WithPointerReferences())
+	require.NoError(t, err)
+
+	var decoded map[*graphNode]int
+	require.NoError(t, UnmarshalJSON(out, &decoded))
+	require.Len(t, decoded, len(nodes))
+	for node, i := range decoded {
+		assert.Equal(t, node.id, i)
+	}
+}
@@ -0,0 +1,136 @@
+package unsafely
+
+import (
+	"errors"
+	"testing"
+	"unsafe"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Tests that unsupported values are replaced by placeholders with
+// WithPlaceholders.
+func TestMarshalJSON_Placeholders(t *testing.T) {
+	type placeholderItem struct {
+		name string
+		raw  unsafe.Pointer
+	}
+
+	type placeholderExample struct {
+		items  []placeholderItem
+		byName map[string]*placeholderItem
+	}
+
+	x := 1
+	in := placeholderExample{
+		items:  []placeholderItem{{name: "a"}, {name: "b", raw: unsafe.Pointer(&x)}},
+		byName: map[string]*placeholderItem{"c": {name: "c"}},
+	}
+
+	_, err := MarshalJSON(in)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unsupported kind unsafe.Pointer")
+
+	encoder := NewJSONEncoder(WithPlaceholders())
+	out, err := encoder.Encode(in)
+	require.NoError(t, err)
+
+	reason := "createEncodedTypeFor: unsupported kind unsafe.Pointer for unsafe.Pointer"
+	expected := []Placeholder{
+		{Kind: "unsafe.Pointer", Type: "unsafe.Pointer", Path: "value.items[0].raw", Reason: reason},
+		{Kind: "unsafe.Pointer", Type: "unsafe.Pointer", Path: "value.items[1].raw", Reason: reason},
+		{Kind: "unsafe.Pointer", Type: "unsafe.Pointer", Path: `value.byName["c"].raw`, Reason: reason},
+	}
+	assert.Equal(t, expected, encoder.Placeholders())
+
+	// Placeholders are reported for each call to Encode. The pointer in the map
+	// was already encoded, so its value is not encoded again.
+	_, err = encoder.Encode(in)
+	require.NoError(t, err)
+	assert.Equal(t, expected[:2], encoder.Placeholders())
+
+	assert.JSONEq(t, `{
+		"options": {"placeholders": true},
+		"value": {
+			"items": [
+				{"name": "a", "raw": {"kind": "unsafe.Pointer", "type": "unsafe.Pointer", "path": "value.items[0].raw", "reason": "`+reason+`"}},
+				{"name": "b", "raw": {"kind": "unsafe.Pointer", "type": "unsafe.Pointer", "path": "value.items[1].raw", "reason": "`+reason+`"}}
+			],
+			"byName": {
+				"c": {"pointer": 1, "value": {"name": "c", "raw": {"kind": "unsafe.Pointer", "type": "unsafe.Pointer", "path": "value.byName[\"c\"].raw", "reason": "`+reason+`"}}}
+			}
+		}
+	}`, string(out))
+
+	var decoded placeholderExample
+	err = UnmarshalJSON(out, &decoded)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unsafe.Pointer at value.items[0].raw was not encoded")
+
+	decoded = placeholderExample{}
+	require.NoError(t, UnmarshalJSON(out, &decoded, WithPlaceholdersAsZero()))
+	assert.Equal(t, placeholderExample{
+		items:  []placeholderItem{{name: "a"}, {name: "b"}},
+		byName: map[string]*placeholderItem{"c": {name: "c"}},
+	}, decoded)
+}
+
+type placeholderFailing struct {
+	fail bool
+}
+
+func (p placeholderFailing) MarshalJSON() ([]byte, error) {
+	if p.fail {
+		return nil, errors.New("cannot marshal")
+	}
+	return []byte(`{"value": "ok"}`), nil
+}
+
+func (p *placeholderFailing) UnmarshalJSON(b []byte) error {
+	p.fail = false
+	return nil
+}
+
+// Tests that values whose marshalers fail are replaced by placeholders with
+// WithPlaceholders.
+func TestMarshalJSON_Placeholders_MarshalerErrors(t *testing.T) {
+	type placeholderMarshalers struct {
+		ok     placeholderFailing
+		failed placeholderFailing
+	}
+
+	in := placeholderMarshalers{failed: placeholderFailing{fail: true}}
+
+	_, err := MarshalJSON(in)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "cannot marshal")
+
+	encoder := NewJSONEncoder(WithPlaceholders())
+	out, err := encoder.Encode(in)
+	require.NoError(t, err)
+
+	reason := "encodeWithMarshaler(): custom json.Marshal for unsafely.placeholderFailing failed: " +
+		"json: error calling MarshalJSON for type *unsafely.placeholderFailing: cannot marshal"
+	expected := []Placeholder{
+		{Kind: "struct", Type: "unsafely.placeholderFailing", Path: "value.failed", Reason: reason},
+	}
+	assert.Equal(t, expected, encoder.Placeholders())
+
+	// Output that looks like a placeholder is annotated.
+	assert.JSONEq(t, `{
+		"options": {"placeholders": true},
+		"value": {
+			"ok": {"value": {"value": "ok"}},
+			"failed": {"placeholder": {"kind": "struct", "type": "unsafely.placeholderFailing", "path": "value.failed", "reason": "`+reason+`"}}
+		}
+	}`, string(out))
+
+	var decoded placeholderMarshalers
+	err = UnmarshalJSON(out, &decoded)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unsafely.placeholderFailing at value.failed was not encoded")
+
+	require.NoError(t, UnmarshalJSON(out, &decoded, WithPlaceholdersAsZero()))
+	assert.Equal(t, placeholderMarshalers{}, decoded)
+}
@@ -0,0 +1,330 @@
+package unsafely
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/outriggerlabs/unsafely/typeutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type pointerIDsNode struct {
+	value int
+	next  *pointerIDsNode
+}
+
+func makePointerIDsList(n int) *pointerIDsNode {
+	var head *pointerIDsNode
+	for i := n; i > 0; i-- {
+		head = &pointerIDsNode{value: i, next: head}
+	}
+	return head
+}
+
+func TestMarshalJSON_PointerIDs(t *testing.T) {
+	type example struct {
+		items []*pointerIDsNode
+		first *pointerIDsNode
+	}
+
+	list := makePointerIDsList(2)
+	in := example{
+		items: []*pointerIDsNode{list, list.next},
+		first: list,
+	}
+
+	tests := map[string]struct {
+		mode     PointerIDs
+		expected string
+	}{
+		"post-order": {
+			mode: PostOrderPointerIDs,
+			expected: `{"value":{
+				"items": [
+					{"pointer": 3, "value": {"value": 1, "next": {"pointer": 2, "value": {"value": 2, "next": {"pointer": 1, "value": null}}}}},
+					{"pointer": 2, "value": {"value": 2, "next": {"pointer": 1, "value": null}}}
+				],
+				"first": {"pointer": 3, "value": {"value": 1, "next": {"pointer": 2, "value": {"value": 2, "next": {"pointer": 1, "value": null}}}}}
+			}}`,
+		},
+		"pre-order": {
+			mode: PreOrderPointerIDs,
+			expected: `{"value":{
+				"items": [
+					{"pointer": 1, "value": {"value": 1, "next": {"pointer": 2, "value": {"value": 2, "next": {"pointer": 3, "value": null}}}}},
+					{"pointer": 2, "value": {"value": 2, "next": {"pointer": 3, "value": null}}}
+				],
+				"first": {"pointer": 1, "value": {"value": 1, "next": {"pointer": 2, "value": {"value": 2, "next": {"pointer": 3, "value": null}}}}}
+			}}`,
+		},
+		"path": {
+			mode: PathPointerIDs,
+			expected: `{"value":{
+				"items": [
+					{"pointer": "#/value/items/0", "value": {"value": 1, "next": {"pointer": "#/value/items/0/value/next", "value": {"value": 2, "next": {"pointer": "#/value/items/0/value/next/value/next", "value": null}}}}},
+					{"pointer": "#/value/items/0/value/next", "value": {"value": 2, "next": {"pointer": "#/value/items/0/value/next/value/next", "value": null}}}
+				],
+				"first": {"pointer": "#/value/items/0", "value": {"value": 1, "next": {"pointer": "#/value/items/0/value/next", "value": {"value": 2, "next": {"pointer": "#/value/items/0/value/next/value/next", "value": null}}}}}
+			}}`,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			out, err := MarshalJSON(in, WithPointerIDs(tt.mode))
+			require.NoError(t, err)
+			assert.JSONEq(t, tt.expected, string(out))
+
+			var decoded example
+			require.NoError(t, UnmarshalJSON(out, &decoded))
+			assert.Equal(t, in, decoded)
+			assert.Same(t, decoded.first, decoded.items[0])
+			assert.Same(t, decoded.first.next, decoded.items[1])
+		})
+	}
+}
+
+// Path IDs don't change when unrelated values are added.
+func TestMarshalJSON_PointerIDs_Stable(t *testing.T) {
+	type before struct {
+		items []*int
+	}
+
+	type after struct {
+		extra *int
+		items []*int
+	}
+
+	items := []*int{ptrTo(1), ptrTo(2)}
+
+	out1, err := MarshalJSON(before{items: items}, WithPointerIDs(PathPointerIDs))
+	require.NoError(t, err)
+
+	out2, err := MarshalJSON(after{extra: ptrTo(0), items: items}, WithPointerIDs(PathPointerIDs))
+	require.NoError(t, err)
+
+	assert.JSONEq(t, `{"value":{"items":[
+		{"pointer": "#/value/items/0", "value": 1},
+		{"pointer": "#/value/items/1", "value": 2}
+	]}}`, string(out1))
+	assert.JSONEq(t, `{"value":{"extra":{"pointer": "#/value/extra", "value": 0},"items":[
+		{"pointer": "#/value/items/0", "value": 1},
+		{"pointer": "#/value/items/1", "value": 2}
+	]}}`, string(out2))
+}
+
+// Later documents encoded with the same JSONEncoder reuse the IDs of earlier
+// documents, and don't reuse IDs for different pointers.
+func TestMarshalJSON_PointerIDs_MultipleDocuments(t *testing.T) {
+	type example struct {
+		a *int
+		b *int
+	}
+
+	var (
+		shared = ptrTo(1)
+		other  = ptrTo(2)
+	)
+
+	encoder := NewJSONEncoder(WithPointerIDs(PathPointerIDs))
+
+	out1, err := encoder.Encode(example{a: shared})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"value":{"a":{"pointer":"#/value/a","value":1},"b":{"pointer":"#/value/b","value":null}}}`, string(out1))
+
+	out2, err := encoder.Encode(example{a: other, b: shared})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"value":{"a":{"pointer":"#/value/a@2","value":2},"b":{"pointer":"#/value/a","value":1}}}`, string(out2))
+
+	decoder := NewJSONDecoder()
+
+	var decoded1, decoded2 example
+	require.NoError(t, decoder.Decode(out1, &decoded1))
+	require.NoError(t, decoder.Decode(out2, &decoded2))
+	assert.Same(t, decoded1.a, decoded2.b)
+	assert.Equal(t, 2, *decoded2.a)
+}
+
+func TestCanonicalizePointerIDs(t *testing.T) {
+	type key struct {
+		ptr *int
+	}
+
+	type example struct {
+		list  *pointerIDsNode
+		keys  map[key]int
+		inner *int
+	}
+
+	list := makePointerIDsList(3)
+	in := example{
+		list:  list,
+		keys:  map[key]int{{ptr: ptrTo(42)}: 1},
+		inner: &list.next.value,
+	}
+
+	out, err := MarshalJSON(in, WithIndent("  "))
+	require.NoError(t, err)
+
+	var canonicalized example
+	canonical, err := CanonicalizePointerIDs(out, &canonicalized, WithIndent("  "))
+	require.NoError(t, err)
+
+	expected, err := MarshalJSON(in, WithIndent("  "), WithPointerIDs(PathPointerIDs))
+	require.NoError(t, err)
+	assert.Equal(t, string(expected), string(canonical))
+	assert.Contains(t, string(canonical), `"{\"ptr\":{\"pointer\":\"#/value/keys/$keys/{\\\"ptr\\\":{\\\"pointer\\\":1,\\\"value\\\":42}}/ptr\",\"value\":42}}": 1`)
+	assert.Contains(t, string(canonical), `"pointer": "#/value/list/value/next"`)
+
+	var decoded example
+	require.NoError(t, UnmarshalJSON(canonical, &decoded))
+	assert.Same(t, &decoded.list.next.value, decoded.inner)
+}
+
+// Tests that values with interface fields can be canonicalized using a type
+// resolver, and that references to pointers in earlier documents from the same
+// JSONEncoder are rewritten.
+func TestPointerIDCanonicalizer(t *testing.T) {
+	type example struct {
+		iface  any
+		shared *int
+	}
+
+	shared := ptrTo(1)
+	in1 := example{iface: ptrTo(2), shared: shared}
+	in2 := example{iface: "value", shared: shared}
+
+	encodeAll := func(options ...MarshalJSONOption) [][]byte {
+		encoder := NewJSONEncoder(options...)
+		var outs [][]byte
+		for _, in := range []example{in1, in2} {
+			out, err := encoder.Encode(in)
+			require.NoError(t, err)
+			outs = append(outs, out)
+		}
+		return outs
+	}
+
+	outs := encodeAll(WithPointerReferences())
+	expected := encodeAll(WithPointerReferences(), WithPointerIDs(PathPointerIDs))
+
+	// The interface field can't be unmarshaled without a type resolver.
+	var canonicalized example
+	_, err := CanonicalizePointerIDs(outs[0], &canonicalized)
+	require.Error(t, err)
+
+	canonicalizer := NewPointerIDCanonicalizer(
+		NewJSONDecoder(WithTypeResolver(typeutil.UnsafeResolver())), WithPointerReferences(),
+	)
+	for i, out := range outs {
+		var canonicalized example
+		canonical, err := canonicalizer.Canonicalize(out, &canonicalized)
+		require.NoError(t, err)
+		assert.Equal(t, string(expected[i]), string(canonical))
+	}
+	assert.Contains(t, string(expected[1]), `"shared":{"pointer":"#/value/shared"}`)
+}
+
+// Tests that the paths of pointers in map keys don't depend on the other keys
+// in the map.
+func TestMarshalJSON_PointerIDs_MapKeys(t *testing.T) {
+	type key struct {
+		ptr *int
+	}
+
+	keyPointerID := func(m map[key]bool, k key) string {
+		out, err := MarshalJSON(m, WithPointerIDs(PathPointerIDs))
+		require.NoError(t, err)
+
+		var decoded struct {
+			Value map[string]bool `json:"value"`
+		}
+		require.NoError(t, json.Unmarshal(out, &decoded))
+
+		for encodedKey := range decoded.Value {
+			var encoded struct {
+				Ptr struct {
+					Pointer string `json:"pointer"`
+					Value   int    `json:"value"`
+				} `json:"ptr"`
+			}
+			require.NoError(t, json.Unmarshal([]byte(encodedKey), &encoded))
+			if encoded.Ptr.Value == *k.ptr {
+				return encoded.Ptr.Pointer
+			}
+		}
+
+		require.FailNow(t, "key not found")
+		return ""
+	}
+
+	k := key{ptr: ptrTo(2)}
+	id := keyPointerID(map[key]bool{k: true}, k)
+	assert.Equal(t, `#/value/$keys/{"ptr":{"pointer":1,"value":2}}/ptr`, id)
+
+	// Adding a key that is sorted first doesn't change the path.
+	assert.Equal(t, id, keyPointerID(map[key]bool{k: true, {ptr: ptrTo(1)}: true}, k))
+}
+
+// Tests that values with the same structure as pointers are not rewritten.
+func TestMarshalJSON_PointerIDs_Lookalikes(t *testing.T) {
+	type lookalike struct {
+		Pointer int `json:"pointer"`
+	}
+
+	type example struct {
+		a    lookalike
+		b    *int
+		keys map[lookalike]*int
+	}
+
+	in := example{
+		a:    lookalike{Pointer: 7},
+		b:    ptrTo(1),
+		keys: map[lookalike]*int{{Pointer: 8}: ptrTo(2)},
+	}
+
+	tests := map[string]struct {
+		mode     PointerIDs
+		expected string
+	}{
+		"pre-order": {
+			mode: PreOrderPointerIDs,
+			expected: `{"value":{
+				"a": {"pointer": 7},
+				"b": {"pointer": 1, "value": 1},
+				"keys": {"{\"pointer\":8}": {"pointer": 2, "value": 2}}
+			}}`,
+		},
+		"path": {
+			mode: PathPointerIDs,
+			expected: `{"value":{
+				"a": {"pointer": 7},
+				"b": {"pointer": "#/value/b", "value": 1},
+				"keys": {"{\"pointer\":8}": {"pointer": "#/value/keys/{\"pointer\":8}", "value": 2}}
+			}}`,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			out, err := MarshalJSON(in, WithPointerIDs(tt.mode))
+			require.NoError(t, err)
+			assert.JSONEq(t, tt.expected, string(out))
+
+			var decoded example
+			require.NoError(t, UnmarshalJSON(out, &decoded))
+			assert.Equal(t, in, decoded)
+		})
+	}
+
+	// Canonicalizing the default output doesn't rewrite the lookalikes either.
+	out, err := MarshalJSON(in)
+	require.NoError(t, err)
+
+	var canonicalized example
+	canonical, err := CanonicalizePointerIDs(out, &canonicalized)
+	require.NoError(t, err)
+	assert.JSONEq(t, tests["path"].expected, string(canonical))
+}
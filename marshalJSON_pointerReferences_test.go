@@ -0,0 +1,98 @@
+package unsafely
+
+import (
+	"testing"
+
+	"github.com/outriggerlabs/unsafely/typeutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Tests that shared pointer values are only included once with
+// WithPointerReferences.
+func TestMarshalJSON_PointerReferences(t *testing.T) {
+	type shared struct {
+		name string
+	}
+
+	type example struct {
+		first  *shared
+		second *shared
+		slice  []*shared
+	}
+
+	s := &shared{name: "shared"}
+	in := example{first: s, second: s, slice: []*shared{s, nil}}
+
+	out, err := MarshalJSON(in, WithPointerReferences())
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"value": {
+			"first": {"pointer": 1, "value": {"name": "shared"}},
+			"second": {"pointer": 1},
+			"slice": [{"pointer": 1}, {"pointer": 2, "value": null}]
+		}
+	}`, string(out))
+
+	var decoded example
+	require.NoError(t, UnmarshalJSON(out, &decoded))
+	assert.Equal(t, in, decoded)
+	assert.Same(t, decoded.first, decoded.second)
+	assert.Same(t, decoded.first, decoded.slice[0])
+}
+
+// Map entries and interfaces are decoded into temporary values, so references
+// that are resolved later must be copied to the map and interface.
+func TestMarshalJSON_PointerReferences_ForwardReferences(t *testing.T) {
+	type forwardRefNode struct {
+		value int
+	}
+
+	type forwardRefEntry struct {
+		node *forwardRefNode
+	}
+
+	type forwardRefEntrySet map[forwardRefEntry]int
+
+	n := &forwardRefNode{value: 42}
+
+	in := map[string]any{
+		"a": n,
+		"b": n,
+		"c": forwardRefEntry{node: n},
+		"d": forwardRefEntrySet{{node: n}: 1},
+	}
+
+	out, err := MarshalJSON(in, WithPointerReferences())
+	require.NoError(t, err)
+
+	// Map iteration order is random, so this exercises references appearing
+	// before and after the pointer value.
+	for range 20 {
+		var decoded map[string]any
+		require.NoError(t, UnmarshalJSON(out, &decoded, WithTypeResolver(typeutil.UnsafeResolver())))
+		require.Len(t, decoded, len(in))
+
+		var (
+			a = decoded["a"].(*forwardRefNode)
+			b = decoded["b"].(*forwardRefNode)
+			c = decoded["c"].(forwardRefEntry)
+			d = decoded["d"].(forwardRefEntrySet)
+		)
+		assert.Equal(t, 42, a.value)
+		assert.Same(t, a, b)
+		assert.Same(t, a, c.node)
+		assert.Equal(t, forwardRefEntrySet{{node: a}: 1}, d)
+	}
+}
+
+func TestMarshalJSON_PointerReferences_Unresolved(t *testing.T) {
+	type example struct {
+		ptr *int
+	}
+
+	b := []byte(`{"value":{"ptr":{"pointer":1}}}`)
+
+	var decoded example
+	require.ErrorContains(t, UnmarshalJSON(b, &decoded), `references to unknown pointers ["1"]`)
+}
@@ -0,0 +1,97 @@
+package unsafely
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Tests that WithReadableOutput encodes printable bytes as text and other bytes
+// as hex, strings with multiple lines as arrays of lines, and doesn't escape
+// HTML characters.
+func TestMarshalJSON_ReadableOutput(t *testing.T) {
+	type readable struct {
+		text    []byte
+		binary  []byte
+		control []byte
+		nilText []byte
+		hash    [4]byte
+		lines   string
+		html    string
+		invalid string
+		keys    map[string]string
+	}
+
+	in := readable{
+		text:    []byte("hello"),
+		binary:  []byte{0xde, 0xad, 0xbe, 0xef},
+		control: []byte{0x00, 0x01, '\t', 'a'},
+		hash:    [4]byte{0x00, 0xff, 0x10, 0x80},
+		lines:   "first\nsecond\n",
+		html:    `<a href="x">&amp;</a> \u003c`,
+		invalid: "caf\xe9\nau lait",
+		keys:    map[string]string{"<key>": "a & b"},
+	}
+
+	out, err := MarshalJSON(in, WithIndent("  "), WithReadableOutput())
+	require.NoError(t, err)
+	assert.Equal(t, `{
+  "options": {
+    "readable": true
+  },
+  "value": {
+    "text": {
+      "text": "hello"
+    },
+    "binary": {
+      "hex": "deadbeef"
+    },
+    "control": {
+      "hex": "00010961"
+    },
+    "nilText": null,
+    "hash": {
+      "hex": "00ff1080"
+    },
+    "lines": [
+      "first",
+      "second",
+      ""
+    ],
+    "html": "<a href=\"x\">&amp;</a> \\u003c",
+    "invalid": {
+      "escaped": "caf\\xe9\nau lait"
+    },
+    "keys": {
+      "<key>": "a & b"
+    }
+  }
+}`, string(out))
+
+	var decoded readable
+	require.NoError(t, UnmarshalJSON(out, &decoded))
+	assert.Equal(t, in, decoded)
+}
+
+// Tests that the forms used without WithReadableOutput are also accepted.
+func TestUnmarshalJSON_ReadableOutput_DefaultForms(t *testing.T) {
+	type bytesAndArrays struct {
+		Slice []byte
+		Array [2]byte
+		Lines string
+	}
+
+	var decoded bytesAndArrays
+	require.NoError(t, UnmarshalJSON([]byte(`{
+		"options": {"readable": true},
+		"value": {"Slice": "aGk=", "Array": [1, 2], "Lines": "one line"}
+	}`), &decoded))
+	assert.Equal(t, bytesAndArrays{Slice: []byte("hi"), Array: [2]byte{1, 2}, Lines: "one line"}, decoded)
+
+	err := UnmarshalJSON([]byte(`{
+		"options": {"readable": true},
+		"value": {"Array": {"hex": "010203"}}
+	}`), &decoded)
+	assert.ErrorContains(t, err, "expected 2 bytes")
+}
@@ -0,0 +1,95 @@
+package unsafely
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/outriggerlabs/unsafely/typeutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type reflectHandler struct {
+	Name string
+}
+
+type reflectExample struct {
+	handlers map[reflect.Type]string
+	elemT    reflect.Type
+	anyT     any
+	nilT     reflect.Type
+	value    reflect.Value
+	nilValue reflect.Value
+}
+
+// Tests that reflect.Type values are encoded as type references, including as
+// map keys, and reflect.Value values as their types and underlying values.
+func TestMarshalJSON_Reflect(t *testing.T) {
+	in := reflectExample{
+		handlers: map[reflect.Type]string{
+			reflect.TypeFor[int]():             "int",
+			reflect.TypeFor[*reflectHandler](): "handler",
+		},
+		elemT: reflect.TypeFor[[]string](),
+		anyT:  reflect.TypeFor[reflectHandler](),
+		value: reflect.ValueOf(reflectHandler{Name: "value"}),
+	}
+
+	out, err := MarshalJSON(in)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"value": {
+			"handlers": {
+				"{\"ptrDepth\":1,\"pkgPath\":\"github.com/outriggerlabs/unsafely\",\"typeName\":\"reflectHandler\"}": "handler",
+				"{\"typeName\":\"int\"}": "int"
+			},
+			"elemT": {"typeString": "[]string"},
+			"anyT": {
+				"ptrDepth": 1,
+				"pkgPath": "reflect",
+				"typeName": "rtype",
+				"value": {"pkgPath": "github.com/outriggerlabs/unsafely", "typeName": "reflectHandler"}
+			},
+			"nilT": null,
+			"value": {
+				"type": {"pkgPath": "github.com/outriggerlabs/unsafely", "typeName": "reflectHandler"},
+				"value": {"Name": "value"}
+			},
+			"nilValue": null
+		}
+	}`, string(out))
+
+	// Unnamed types are resolved by their strings, so these must be added to a
+	// resolver.
+	resolver := typeutil.NewChainResolver(
+		typeutil.UnsafeResolver(),
+		typeutil.NewStaticResolver().AddTypes(reflect.TypeFor[[]string]()),
+	)
+
+	var decoded reflectExample
+	require.NoError(t, UnmarshalJSON(out, &decoded, WithTypeResolver(resolver)))
+	assert.Equal(t, in.handlers, decoded.handlers)
+	assert.Equal(t, in.elemT, decoded.elemT)
+	assert.Equal(t, in.anyT, decoded.anyT)
+	assert.Nil(t, decoded.nilT)
+	assert.Equal(t, reflectHandler{Name: "value"}, decoded.value.Interface())
+	assert.False(t, decoded.nilValue.IsValid())
+}
+
+// Tests that reflect.Value values of pointers preserve the pointers.
+func TestMarshalJSON_Reflect_PointerValue(t *testing.T) {
+	type pointerExample struct {
+		handler *reflectHandler
+		value   reflect.Value
+	}
+
+	handler := &reflectHandler{Name: "handler"}
+	in := pointerExample{handler: handler, value: reflect.ValueOf(handler)}
+
+	out, err := MarshalJSON(in)
+	require.NoError(t, err)
+
+	var decoded pointerExample
+	require.NoError(t, UnmarshalJSON(out, &decoded, WithTypeResolver(typeutil.UnsafeResolver())))
+	assert.Same(t, decoded.handler, decoded.value.Interface())
+}
@@ -0,0 +1,120 @@
+package unsafely
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Tests that slices sharing a backing array still share it after unmarshaling
+// with WithSliceAliasing.
+func TestMarshalJSON_SliceAliasing(t *testing.T) {
+	type example struct {
+		buf  []int
+		sub  []int
+		elem *int
+	}
+
+	buf := make([]int, 4, 6)
+	for i := range buf {
+		buf[i] = i + 1
+	}
+
+	in := example{
+		buf:  buf,
+		sub:  buf[2:3],
+		elem: &buf[1],
+	}
+
+	out, err := MarshalJSON(in, WithSliceAliasing())
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"options": {"sliceAliasing": true},
+		"value": {
+			"buf": {"len": 4, "cap": 6, "array": {"pointer": 1, "value": [1, 2, 3, 4, 0, 0]}},
+			"sub": {"len": 1, "cap": 4, "array": {"pointer": 1, "path": "/2"}},
+			"elem": {"pointer": 1, "path": "/1"}
+		}
+	}`, string(out))
+
+	var decoded example
+	require.NoError(t, UnmarshalJSON(out, &decoded))
+	assert.Equal(t, in, decoded)
+	assert.Equal(t, cap(in.buf), cap(decoded.buf))
+	assert.Equal(t, cap(in.sub), cap(decoded.sub))
+
+	// The slices share the same backing array.
+	assert.Same(t, &decoded.buf[2], &decoded.sub[0])
+	assert.Same(t, &decoded.buf[1], decoded.elem)
+
+	decoded.sub = append(decoded.sub, 42)
+	assert.Equal(t, 42, decoded.buf[3])
+}
+
+func TestMarshalJSON_SliceAliasing_NilAndEmpty(t *testing.T) {
+	type named []string
+
+	type example struct {
+		nilSlice   []string
+		emptySlice []string
+		named      named
+		nested     [][]int
+	}
+
+	in := example{
+		emptySlice: []string{},
+		named:      named{"a", "b"},
+		nested:     [][]int{{1}, nil, {}},
+	}
+
+	out, err := MarshalJSON(in, WithSliceAliasing())
+	require.NoError(t, err)
+
+	var decoded example
+	require.NoError(t, UnmarshalJSON(out, &decoded))
+	assert.Equal(t, in, decoded)
+	assert.Nil(t, decoded.nilSlice)
+	assert.NotNil(t, decoded.emptySlice)
+}
+
+// Without WithSliceAliasing, slices are copied independently.
+func TestMarshalJSON_SliceAliasing_Disabled(t *testing.T) {
+	type example struct {
+		buf []int
+		sub []int
+	}
+
+	buf := []int{1, 2, 3}
+	in := example{buf: buf, sub: buf[1:]}
+
+	out, err := MarshalJSON(in)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"value":{"buf":[1,2,3],"sub":[2,3]}}`, string(out))
+
+	var decoded example
+	require.NoError(t, UnmarshalJSON(out, &decoded))
+	assert.Equal(t, in, decoded)
+	assert.NotSame(t, &decoded.buf[1], &decoded.sub[0])
+}
+
+// Capacities that exceed the encoded backing array are rejected, rather than
+// allocating or zero-filling the missing elements.
+func TestMarshalJSON_SliceAliasing_InvalidCap(t *testing.T) {
+	type example struct {
+		buf []int
+	}
+
+	for name, buf := range map[string]string{
+		"exceeds array":  `{"len": 1, "cap": 3, "array": {"pointer": 1, "value": [1, 2]}}`,
+		"exceeds memory": `{"len": 1, "cap": 9223372036854775807, "array": {"pointer": 1, "value": [1]}}`,
+		"below length":   `{"len": 2, "cap": 1, "array": {"pointer": 1, "value": [1]}}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			in := `{"options": {"sliceAliasing": true}, "value": {"buf": ` + buf + `}}`
+
+			var decoded example
+			assert.Error(t, UnmarshalJSON([]byte(in), &decoded))
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package unsafely
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Tests that strings containing invalid UTF-8, including map keys, are
+// restored byte-for-byte, and that valid strings are plain JSON strings.
+func TestMarshalJSON_Strings(t *testing.T) {
+	type namedString string
+
+	type binaryStrings struct {
+		valid   string
+		invalid string
+		named   namedString
+		ptr     *string
+		keys    map[string]int
+		values  []any
+	}
+
+	in := binaryStrings{
+		valid:   `caf\é`,
+		invalid: "caf\xe9 \\x00",
+		named:   "\xff\xfe",
+		ptr:     ptrTo("\x80"),
+		keys:    map[string]int{"valid": 1, "in\xc3valid": 2, "\x00null": 3},
+		values:  []any{"\xe2\x82", namedString("ok")},
+	}
+
+	out, err := MarshalJSON(in)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"value": {
+			"valid": "caf\\é",
+			"invalid": {"escaped": "caf\\xe9 \\\\x00"},
+			"named": {"escaped": "\\xff\\xfe"},
+			"ptr": {"pointer": 1, "value": {"escaped": "\\x80"}},
+			"keys": {
+				"valid": 1,
+				"\u0000in\\xc3valid": 2,
+				"\u0000\u0000null": 3
+			},
+			"values": [
+				{"typeName": "string", "value": {"escaped": "\\xe2\\x82"}},
+				{"pkgPath": "github.com/outriggerlabs/unsafely", "typeName": "namedString", "value": "ok"}
+			]
+		}
+	}`, string(out))
+
+	testMarshalJSON(t, map[string]any{
+		"binaryStrings": in,
+		"string":        "\xc0\xaf",
+		"keys":          map[namedString]string{"\xff": "\xfe", "": ""},
+	})
+}
+
+// Tests that escaped strings are validated when unmarshaling.
+func TestUnmarshalJSON_Strings_InvalidEscape(t *testing.T) {
+	var s string
+	err := UnmarshalJSON([]byte(`{"value": {"escaped": "\\q"}}`), &s)
+	assert.ErrorContains(t, err, "invalid escape")
+
+	var m map[string]int
+	err = UnmarshalJSON([]byte(`{"value": {"\u0000\\xzz": 1}}`), &m)
+	assert.ErrorContains(t, err, "invalid escape")
+}
@@ -0,0 +1,159 @@
+package unsafely
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/outriggerlabs/unsafely/typeutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type syncNode struct {
+	Name string
+}
+
+type syncExample struct {
+	mu      sync.Mutex
+	rw      sync.RWMutex
+	wg      sync.WaitGroup
+	once    sync.Once
+	pool    sync.Pool
+	count   atomic.Int64
+	enabled atomic.Bool
+	node    atomic.Pointer[syncNode]
+	value   atomic.Value
+}
+
+// Tests that sync primitives and atomics are encoded by their states and
+// loaded values, and that locks are decoded unlocked by default.
+func TestMarshalJSON_Sync(t *testing.T) {
+	in := &syncExample{}
+	in.mu.Lock()
+	in.rw.RLock()
+	in.rw.RLock()
+	in.wg.Add(2)
+	in.once.Do(func() {})
+	in.pool.Put("cached")
+	in.count.Store(42)
+	in.enabled.Store(true)
+	in.node.Store(&syncNode{Name: "node"})
+	in.value.Store("stored")
+
+	out, err := MarshalJSON(in)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"value": {
+			"pointer": 2,
+			"value": {
+				"mu": {"locked": true},
+				"rw": {"locked": false, "readers": 2},
+				"wg": {"count": 2},
+				"once": {"done": true},
+				"count": 42,
+				"enabled": true,
+				"node": {"pointer": 1, "value": {"Name": "node"}},
+				"value": {"typeName": "string", "value": "stored"}
+			}
+		}
+	}`, string(out))
+
+	var decoded *syncExample
+	require.NoError(t, UnmarshalJSON(out, &decoded, WithTypeResolver(typeutil.UnsafeResolver())))
+	require.NotNil(t, decoded)
+
+	assert.True(t, decoded.mu.TryLock())
+	assert.True(t, decoded.rw.TryLock())
+	decoded.wg.Wait()
+
+	called := false
+	decoded.once.Do(func() { called = true })
+	assert.False(t, called)
+
+	assert.Equal(t, int64(42), decoded.count.Load())
+	assert.True(t, decoded.enabled.Load())
+	assert.Equal(t, &syncNode{Name: "node"}, decoded.node.Load())
+	assert.Equal(t, "stored", decoded.value.Load())
+}
+
+// Tests that lock states are restored with WithLockStates.
+func TestMarshalJSON_Sync_LockStates(t *testing.T) {
+	type locks struct {
+		mu      sync.Mutex
+		writer  sync.RWMutex
+		readers sync.RWMutex
+		wg      sync.WaitGroup
+	}
+
+	in := &locks{}
+	in.mu.Lock()
+	in.writer.Lock()
+	in.readers.RLock()
+	in.wg.Add(1)
+
+	out, err := MarshalJSON(in)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"value": {
+			"pointer": 1,
+			"value": {
+				"mu": {"locked": true},
+				"writer": {"locked": true, "readers": 0},
+				"readers": {"locked": false, "readers": 1},
+				"wg": {"count": 1}
+			}
+		}
+	}`, string(out))
+
+	var decoded *locks
+	require.NoError(t, UnmarshalJSON(out, &decoded, WithLockStates()))
+	require.NotNil(t, decoded)
+
+	assert.False(t, decoded.mu.TryLock())
+	assert.False(t, decoded.writer.TryRLock())
+	assert.True(t, decoded.readers.TryRLock())
+	assert.False(t, decoded.readers.TryLock())
+
+	out, err = MarshalJSON(decoded)
+	require.NoError(t, err)
+	assert.Contains(t, string(out), `"wg":{"count":1}`)
+}
+
+// Tests that sync.Map is encoded as its contents, and that atomic pointers
+// preserve shared pointers.
+func TestMarshalJSON_Sync_MapAndSharedPointers(t *testing.T) {
+	type syncShared struct {
+		m    sync.Map
+		ptr  atomic.Pointer[syncNode]
+		node *syncNode
+	}
+
+	node := &syncNode{Name: "shared"}
+	in := &syncShared{node: node}
+	in.m.Store("b", 2)
+	in.m.Store("a", 1)
+	in.ptr.Store(node)
+
+	out, err := MarshalJSON(in)
+	require.NoError(t, err)
+
+	var decoded *syncShared
+	require.NoError(t, UnmarshalJSON(out, &decoded, WithTypeResolver(typeutil.UnsafeResolver())))
+	require.NotNil(t, decoded)
+
+	a, ok := decoded.m.Load("a")
+	assert.True(t, ok)
+	assert.Equal(t, 1, a)
+
+	b, ok := decoded.m.Load("b")
+	assert.True(t, ok)
+	assert.Equal(t, 2, b)
+
+	assert.Same(t, decoded.node, decoded.ptr.Load())
+}
+
+// Tests that the layouts match the sync types in this runtime.
+func TestMarshalJSON_Sync_Layouts(t *testing.T) {
+	require.NoError(t, checkSyncLayouts())
+}
@@ -0,0 +1,138 @@
+package unsafely
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Tests that times are decoded with the same internal fields and location.
+func TestMarshalJSON_Time(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+
+	type timeExample struct {
+		now       time.Time
+		utc       time.Time
+		local     time.Time
+		named     time.Time
+		fixed     time.Time
+		parsed    time.Time
+		fakeUTC   time.Time
+		zero      time.Time
+		loc       *time.Location
+		nilLoc    *time.Location
+		fixedLoc  *time.Location
+		durations []time.Duration
+	}
+
+	instant := time.Date(2024, 3, 10, 12, 30, 0, 500, time.UTC)
+
+	// Numeric offsets are parsed to unnamed locations.
+	parsed, err := time.Parse(time.RFC3339, "2024-01-01T00:00:00+02:00")
+	require.NoError(t, err)
+
+	in := timeExample{
+		now:       time.Now(), // includes a monotonic clock reading
+		utc:       instant,
+		local:     instant.Local(),
+		named:     instant.In(newYork),
+		fixed:     instant.In(time.FixedZone("PLUS2", 2*60*60)),
+		parsed:    parsed,
+		fakeUTC:   instant.In(time.FixedZone("UTC", 60*60)),
+		loc:       newYork,
+		fixedLoc:  time.FixedZone("MINUS5", -5*60*60),
+		durations: []time.Duration{time.Second},
+	}
+
+	out, err := MarshalJSON(in)
+	require.NoError(t, err)
+
+	var decoded timeExample
+	require.NoError(t, UnmarshalJSON(out, &decoded))
+
+	assert.True(t, in.now == decoded.now, "monotonic clock reading should be preserved")
+	assert.True(t, in.utc == decoded.utc)
+	assert.True(t, in.local == decoded.local)
+	assert.True(t, in.zero == decoded.zero)
+	assert.True(t, in.named.Equal(decoded.named))
+	assert.Equal(t, "America/New_York", decoded.named.Location().String())
+	assert.Equal(t, in.named.String(), decoded.named.String())
+	assert.Equal(t, in.fixed.String(), decoded.fixed.String())
+	assert.True(t, in.parsed == decoded.parsed)
+	assert.Equal(t, in.parsed.String(), decoded.parsed.String())
+	assert.Equal(t, in.fakeUTC.String(), decoded.fakeUTC.String())
+	assert.Same(t, decoded.named.Location(), decoded.loc)
+	assert.Equal(t, "America/New_York", decoded.loc.String())
+	assert.Nil(t, decoded.nilLoc)
+	assert.Equal(t, in.fixedLoc.String(), decoded.fixedLoc.String())
+	assert.Equal(t, instant.In(in.fixedLoc).String(), instant.In(decoded.fixedLoc).String())
+	assert.Equal(t, in.durations, decoded.durations)
+}
+
+// Tests the encoded representation of times.
+func TestMarshalJSON_Time_Encoded(t *testing.T) {
+	type timeEncoded struct {
+		utc   time.Time
+		fixed time.Time
+		loc   *time.Location
+	}
+
+	instant := time.Date(2024, 3, 10, 12, 30, 0, 0, time.UTC)
+	in := timeEncoded{
+		utc:   instant,
+		fixed: instant.In(time.FixedZone("PLUS2", 2*60*60)),
+		loc:   time.UTC,
+	}
+
+	out, err := MarshalJSON(in)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"value": {
+			"utc": {"time": "2024-03-10T12:30:00Z", "wall": 0, "ext": 63845670600},
+			"fixed": {
+				"time": "2024-03-10T14:30:00+02:00",
+				"wall": 0,
+				"ext": 63845670600,
+				"loc": {"name": "PLUS2", "offset": 7200}
+			},
+			"loc": {"name": "UTC"}
+		}
+	}`, string(out))
+}
+
+// Tests that locations whose names can be loaded, but with different offsets,
+// keep their offsets.
+func TestMarshalJSON_Time_FixedZoneWithLoadableName(t *testing.T) {
+	type fixedZones struct {
+		fixed    time.Time
+		fixedLoc *time.Location
+	}
+
+	// "EST" is also the name of a location in the time zone database, which is
+	// 5 hours behind UTC.
+	est := time.FixedZone("EST", 0)
+	instant := time.Date(2024, 3, 10, 12, 30, 0, 0, time.UTC)
+	in := fixedZones{fixed: instant.In(est), fixedLoc: est}
+
+	out, err := MarshalJSON(in)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"value": {
+			"fixed": {
+				"time": "2024-03-10T12:30:00Z",
+				"wall": 0,
+				"ext": 63845670600,
+				"loc": {"name": "EST", "offset": 0}
+			},
+			"fixedLoc": {"name": "EST", "offset": 0}
+		}
+	}`, string(out))
+
+	var decoded fixedZones
+	require.NoError(t, UnmarshalJSON(out, &decoded))
+	assert.Equal(t, in.fixed.String(), decoded.fixed.String())
+	assert.Equal(t, instant.In(est).String(), instant.In(decoded.fixedLoc).String())
+}
@@ -0,0 +1,85 @@
+package unsafely
+
+import (
+	"net/netip"
+	"testing"
+	"unique"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type uniqueKey struct {
+	Name    string
+	Version int
+}
+
+// Tests that unique.Handle values are encoded as their values, and decoded
+// using unique.Make, so decoded handles are equal to other handles.
+func TestMarshalJSON_Unique(t *testing.T) {
+	type uniqueExample struct {
+		key     unique.Handle[uniqueKey]
+		name    unique.Handle[string]
+		missing unique.Handle[string]
+	}
+
+	in := uniqueExample{
+		key:  unique.Make(uniqueKey{Name: "key", Version: 1}),
+		name: unique.Make("name"),
+	}
+
+	out, err := MarshalJSON(in)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"value": {
+			"key": {"Name": "key", "Version": 1},
+			"name": "name",
+			"missing": null
+		}
+	}`, string(out))
+
+	var decoded uniqueExample
+	require.NoError(t, UnmarshalJSON(out, &decoded, WithUniqueMakers(
+		UniqueMakerFor[uniqueKey](),
+		UniqueMakerFor[string](),
+	)))
+	assert.True(t, decoded.key == in.key)
+	assert.True(t, decoded.name == in.name)
+	assert.Equal(t, unique.Handle[string]{}, decoded.missing)
+
+	// Handles can't be created without a UniqueMaker.
+	err = UnmarshalJSON(out, &decoded)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "no UniqueMaker for unsafely.uniqueKey")
+}
+
+// Tests that netip addresses are encoded as text and remain comparable.
+func TestMarshalJSON_Unique_NetipAddr(t *testing.T) {
+	type addrExample struct {
+		v4     netip.Addr
+		v6     netip.Addr
+		prefix netip.Prefix
+		zero   netip.Addr
+	}
+
+	in := addrExample{
+		v4:     netip.MustParseAddr("192.0.2.1"),
+		v6:     netip.MustParseAddr("fe80::1%eth0"),
+		prefix: netip.MustParsePrefix("2001:db8::/32"),
+	}
+
+	out, err := MarshalJSON(in)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"value": {
+			"v4": "192.0.2.1",
+			"v6": "fe80::1%eth0",
+			"prefix": "2001:db8::/32",
+			"zero": ""
+		}
+	}`, string(out))
+
+	var decoded addrExample
+	require.NoError(t, UnmarshalJSON(out, &decoded))
+	assert.True(t, decoded == in)
+}
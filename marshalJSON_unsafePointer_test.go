@@ -0,0 +1,123 @@
+package unsafely
+
+import (
+	"reflect"
+	"testing"
+	"unsafe"
+
+	"github.com/outriggerlabs/unsafely/typeutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type unsafeNode struct {
+	value int
+	next  unsafe.Pointer `unsafely.elem:"github.com/outriggerlabs/unsafely.unsafeNode"`
+}
+
+// Tests that unsafe pointers are encoded as references to other pointers with
+// WithUnsafePointers.
+func TestMarshalJSON_UnsafePointers(t *testing.T) {
+	type unsafeRefNode struct {
+		value int
+	}
+
+	type unsafeRefs struct {
+		head   unsafe.Pointer
+		value  unsafe.Pointer
+		opaque unsafe.Pointer
+		nilPtr unsafe.Pointer
+		node   *unsafeRefNode
+	}
+
+	node := &unsafeRefNode{value: 1}
+	in := unsafeRefs{
+		head:   unsafe.Pointer(node),
+		value:  unsafe.Pointer(&node.value),
+		opaque: unsafe.Pointer(new(int)),
+		node:   node,
+	}
+
+	out, err := MarshalJSON(in, WithUnsafePointers(nil))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"options": {"unsafePointers": true},
+		"value": {
+			"head": {"pointer": 1},
+			"value": {"pointer": 1},
+			"opaque": {"opaque": true},
+			"nilPtr": null,
+			"node": {"pointer": 1, "value": {"value": 1}}
+		}
+	}`, string(out))
+
+	var decoded unsafeRefs
+	require.NoError(t, UnmarshalJSON(out, &decoded))
+	require.NotNil(t, decoded.node)
+	assert.Equal(t, 1, decoded.node.value)
+	assert.Equal(t, unsafe.Pointer(decoded.node), decoded.head)
+	assert.Equal(t, unsafe.Pointer(&decoded.node.value), decoded.value)
+	assert.Nil(t, decoded.opaque)
+	assert.Nil(t, decoded.nilPtr)
+}
+
+// Tests that unsafe pointers into values refer to the offset in the value.
+func TestMarshalJSON_UnsafePointers_Offset(t *testing.T) {
+	type unsafePair struct {
+		a, b int
+	}
+
+	type unsafeOffsets struct {
+		second unsafe.Pointer
+		pair   *unsafePair
+	}
+
+	pair := &unsafePair{a: 1, b: 2}
+	in := unsafeOffsets{second: unsafe.Pointer(&pair.b), pair: pair}
+
+	out, err := MarshalJSON(in, WithUnsafePointers(nil), WithInlinePointers())
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"options": {"unsafePointers": true},
+		"value": {
+			"second": {"pointer": 1, "offset": 8},
+			"pair": {"pointer": 1, "value": {"a": 1, "b": 2}}
+		}
+	}`, string(out))
+
+	var decoded unsafeOffsets
+	require.NoError(t, UnmarshalJSON(out, &decoded))
+	require.NotNil(t, decoded.pair)
+	assert.Equal(t, unsafe.Pointer(&decoded.pair.b), decoded.second)
+}
+
+// Tests that unsafe pointers with type hints are encoded like pointers.
+func TestMarshalJSON_UnsafePointers_TypeHints(t *testing.T) {
+	type unsafeList struct {
+		head unsafe.Pointer `unsafely.elem:"github.com/outriggerlabs/unsafely.unsafeNode"`
+	}
+
+	third := &unsafeNode{value: 3}
+	second := &unsafeNode{value: 2, next: unsafe.Pointer(third)}
+	first := &unsafeNode{value: 1, next: unsafe.Pointer(second)}
+	third.next = unsafe.Pointer(first) // cycle
+
+	resolver := typeutil.NewStaticResolver().AddTypes(reflect.TypeFor[unsafeNode]())
+
+	out, err := MarshalJSON(unsafeList{head: unsafe.Pointer(first)}, WithUnsafePointers(resolver))
+	require.NoError(t, err)
+
+	var decoded unsafeList
+	err = UnmarshalJSON(out, &decoded)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "a type resolver is required")
+
+	require.NoError(t, UnmarshalJSON(out, &decoded, WithTypeResolver(resolver)))
+
+	head := (*unsafeNode)(decoded.head)
+	require.NotNil(t, head)
+	assert.Equal(t, 1, head.value)
+	assert.Equal(t, 2, (*unsafeNode)(head.next).value)
+	assert.Equal(t, 3, (*unsafeNode)((*unsafeNode)(head.next).next).value)
+	assert.Equal(t, decoded.head, (*unsafeNode)((*unsafeNode)(head.next).next).next)
+}
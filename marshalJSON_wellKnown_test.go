@@ -0,0 +1,113 @@
+package unsafely
+
+import (
+	"io"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type wellKnownLogger struct {
+	prefix string
+	out    io.Writer
+}
+
+var (
+	testDefaultLogger = &wellKnownLogger{prefix: "default", out: os.Stderr}
+	testShutdown      = make(chan struct{})
+)
+
+// Tests that well-known instances are encoded by name, and decoded as the same
+// instances.
+func TestMarshalJSON_WellKnown(t *testing.T) {
+	type wellKnownExample struct {
+		logger   *wellKnownLogger
+		out      io.Writer
+		shutdown chan struct{}
+		other    *wellKnownLogger
+	}
+
+	instances := NewWellKnownInstances().
+		Add("unsafely.testDefaultLogger", testDefaultLogger).
+		Add("os.Stdout", os.Stdout).
+		Add("unsafely.testShutdown", testShutdown)
+
+	in := wellKnownExample{
+		logger:   testDefaultLogger,
+		out:      os.Stdout,
+		shutdown: testShutdown,
+		other:    &wellKnownLogger{prefix: "other"},
+	}
+
+	for _, inline := range []bool{false, true} {
+		options := []MarshalJSONOption{WithWellKnown(instances)}
+		if inline {
+			options = append(options, WithInlinePointers())
+		}
+
+		out, err := MarshalJSON(in, options...)
+		require.NoError(t, err)
+
+		expectedOther := `{"pointer": 1, "value": {"prefix": "other", "out": null}}`
+		if inline {
+			expectedOther = `{"prefix": "other", "out": null}`
+		}
+		assert.JSONEq(t, `{
+			"value": {
+				"logger": {"wellKnown": "unsafely.testDefaultLogger"},
+				"out": {"wellKnown": "os.Stdout"},
+				"shutdown": {"wellKnown": "unsafely.testShutdown"},
+				"other": `+expectedOther+`
+			}
+		}`, string(out))
+
+		var decoded wellKnownExample
+		require.NoError(t, UnmarshalJSON(out, &decoded, WithWellKnownResolver(instances)))
+		assert.Same(t, testDefaultLogger, decoded.logger)
+		assert.Same(t, os.Stdout, decoded.out)
+		assert.Equal(t, testShutdown, decoded.shutdown)
+		assert.Equal(t, in.other, decoded.other)
+	}
+}
+
+// Tests that references to unknown or incompatible instances are rejected.
+func TestMarshalJSON_WellKnown_Invalid(t *testing.T) {
+	type loggerField struct {
+		logger *wellKnownLogger
+	}
+
+	instances := NewWellKnownInstances().Add("unsafely.testDefaultLogger", testDefaultLogger)
+	out, err := MarshalJSON(loggerField{logger: testDefaultLogger}, WithWellKnown(instances))
+	require.NoError(t, err)
+
+	var decoded loggerField
+	err = UnmarshalJSON(out, &decoded)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown well-known instance unsafely.testDefaultLogger")
+
+	wrongType := NewWellKnownInstances().Add("unsafely.testDefaultLogger", os.Stdout)
+	err = UnmarshalJSON(out, &decoded, WithWellKnownResolver(wrongType))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "has type *os.File; expected *unsafely.wellKnownLogger")
+}
+
+// Tests that values holding uncomparable values in interface fields are
+// encoded as other values.
+func TestMarshalJSON_WellKnown_Uncomparable(t *testing.T) {
+	type holder struct {
+		X any
+	}
+
+	type anyField struct {
+		value any
+	}
+
+	instances := NewWellKnownInstances().Add("unsafely.testDefaultLogger", testDefaultLogger)
+	in := anyField{value: holder{X: []int{1}}}
+
+	out, err := MarshalJSON(in, WithWellKnown(instances))
+	require.NoError(t, err)
+	assert.NotContains(t, string(out), "wellKnown")
+}
@@ -0,0 +1,287 @@
+package unsafely
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+var (
+	jsonMarshalerType     = reflect.TypeFor[json.Marshaler]()
+	jsonUnmarshalerType   = reflect.TypeFor[json.Unmarshaler]()
+	textMarshalerType     = reflect.TypeFor[encoding.TextMarshaler]()
+	textUnmarshalerType   = reflect.TypeFor[encoding.TextUnmarshaler]()
+	binaryMarshalerType   = reflect.TypeFor[encoding.BinaryMarshaler]()
+	binaryUnmarshalerType = reflect.TypeFor[encoding.BinaryUnmarshaler]()
+
+	bytesType = reflect.TypeFor[[]byte]()
+
+	// The type used to represent the output of marshalers when using
+	// WithPlaceholders.
+	marshaledValueType = reflect.TypeFor[marshaledValue]()
+
+	// Map from types to how they are marshaled, which depends on the options.
+	marshalerKinds = make(map[typeCacheKey]marshalerKind)
+)
+
+// How a type is marshaled, if it implements the standard marshaler interfaces.
+type marshalerKind int
+
+const (
+	// The type is encoded like other types.
+	noMarshaler marshalerKind = iota
+
+	// The type is marshaled using encoding/json, e.g, using its MarshalJSON or
+	// MarshalText method. The encoded value is the raw JSON.
+	jsonMarshaler
+
+	// The type is marshaled using its MarshalBinary method. The encoded value is
+	// the binary data.
+	binaryMarshaler
+)
+
+// Represents the output of a marshaler when using WithPlaceholders. If the
+// marshaler fails, the output is replaced by a placeholder.
+type marshaledValue struct {
+	// Value is the output of a JSON marshaler, or the JSON string of the output
+	// of a binary marshaler.
+	Value json.RawMessage `json:"value,omitempty"`
+
+	// Placeholder is set instead of the value if the marshaler failed.
+	Placeholder *Placeholder `json:"placeholder,omitempty"`
+}
+
+// MarshalJSON implements json.Marshaler.
+//
+// The output of the marshaler is written as-is, unless it would be mistaken
+// for an annotated marshaledValue.
+func (mv marshaledValue) MarshalJSON() ([]byte, error) {
+	if mv.Placeholder == nil && !isMarshaledValueJSON(mv.Value) {
+		return mv.Value, nil
+	}
+
+	type annotated marshaledValue
+	return json.Marshal(annotated(mv))
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (mv *marshaledValue) UnmarshalJSON(b []byte) error {
+	if !isMarshaledValueJSON(b) {
+		*mv = marshaledValue{Value: append(json.RawMessage(nil), b...)}
+		return nil
+	}
+
+	type annotated marshaledValue
+	return json.Unmarshal(b, (*annotated)(mv))
+}
+
+// Returns true if the JSON is a non-empty object with no keys other than
+// those in a marshaledValue.
+func isMarshaledValueJSON(b []byte) bool {
+	fields, ok := objectFields(b, func(key string) bool { return key == "value" || key == "placeholder" })
+	return ok && len(fields) > 0
+}
+
+// Returns the type that stores the output of the marshaler.
+func marshaledTypeFor(kind marshalerKind) reflect.Type {
+	if kind == binaryMarshaler {
+		return bytesType
+	}
+	return jsonRawMessageType
+}
+
+// Returns how values of the type are marshaled.
+//
+// Types are marshaled using encoding/json if they implement json.Marshaler or
+// json.Unmarshaler, or both encoding.TextMarshaler and
+// encoding.TextUnmarshaler. Otherwise, types that implement both
+// encoding.BinaryMarshaler and encoding.BinaryUnmarshaler are marshaled using
+// these. The methods may have value or pointer receivers.
+//
+// Pointers and interfaces are encoded like other pointers and interfaces,
+// which preserves pointer identities. Their underlying values may be
+// marshaled.
+//
+// Marshalers are ignored for types selected by WithoutCustomMarshalers.
+func marshalerKindFor(options encodingOptions, t reflect.Type) marshalerKind {
+	key := typeCacheKey{options: options, inputT: t}
+	if kind, ok := marshalerKinds[key]; ok {
+		return kind
+	}
+
+	kind := noMarshaler
+	switch {
+	case t.Kind() == reflect.Pointer || t.Kind() == reflect.Interface:
+	case options.ignoresMarshalers(t):
+	case implements(t, jsonMarshalerType) || implements(t, jsonUnmarshalerType):
+		kind = jsonMarshaler
+	case implements(t, textMarshalerType) && implements(t, textUnmarshalerType):
+		kind = jsonMarshaler
+	case implements(t, binaryMarshalerType) && implements(t, binaryUnmarshalerType):
+		kind = binaryMarshaler
+	}
+
+	marshalerKinds[key] = kind
+	return kind
+}
+
+// Returns true if map keys of the type are encoded as text, like
+// encoding/json, i.e, if the type implements both encoding.TextMarshaler and
+// encoding.TextUnmarshaler.
+func isTextMapKey(options encodingOptions, t reflect.Type) bool {
+	return t.Kind() != reflect.Interface && t.Kind() != reflect.Pointer && !options.ignoresMarshalers(t) &&
+		implements(t, textMarshalerType) && implements(t, textUnmarshalerType)
+}
+
+// Returns true if the custom marshalers of the type are ignored; see
+// WithoutCustomMarshalers.
+func (o encodingOptions) ignoresMarshalers(t reflect.Type) bool {
+	if o.IgnoreMarshalers == "" {
+		return false
+	}
+
+	for _, ignored := range strings.Split(o.IgnoreMarshalers, ",") {
+		if ignored == "*" || ignored == t.PkgPath() || ignored == t.PkgPath()+"."+t.Name() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Returns true if the type or a pointer to the type implements the interface.
+func implements(t, interfaceT reflect.Type) bool {
+	return t.Implements(interfaceT) || reflect.PointerTo(t).Implements(interfaceT)
+}
+
+// Encodes the value using its marshaler and writes it to encodedV.
+func (s *JSONEncoder) encodeWithMarshaler(kind marshalerKind, originalV, encodedV reflect.Value) error {
+	// With placeholders, the value is replaced by a placeholder if the marshaler
+	// fails.
+	if encodedV.Type() == marshaledValueType {
+		mv, err := s.encodeToMarshaledValue(kind, originalV)
+		if err != nil {
+			return err
+		}
+
+		setField(encodedV, reflect.ValueOf(mv))
+		return nil
+	}
+
+	// Use the pointer, so methods with pointer receivers are called.
+	ptr := ensureAddressable(originalV).Addr().Interface()
+
+	switch kind {
+	case jsonMarshaler:
+		b, err := s.jsonMarshalInternal(ptr)
+		if err != nil {
+			return fmt.Errorf("encodeWithMarshaler(): custom json.Marshal for %v failed: %w", originalV.Type(), err)
+		}
+
+		setField(encodedV, reflect.ValueOf(json.RawMessage(b)))
+
+	case binaryMarshaler:
+		b, err := ptr.(encoding.BinaryMarshaler).MarshalBinary()
+		if err != nil {
+			return fmt.Errorf("encodeWithMarshaler(): MarshalBinary for %v failed: %w", originalV.Type(), err)
+		}
+
+		setField(encodedV, reflect.ValueOf(b))
+
+	default:
+		return fmt.Errorf("encodeWithMarshaler(): %v does not have a marshaler", originalV.Type())
+	}
+
+	return nil
+}
+
+// Encodes the value using its marshaler to a marshaledValue, or to a
+// placeholder if the marshaler fails.
+func (s *JSONEncoder) encodeToMarshaledValue(kind marshalerKind, originalV reflect.Value) (marshaledValue, error) {
+	outputV := reflect.New(marshaledTypeFor(kind)).Elem()
+	if err := s.encodeWithMarshaler(kind, originalV, outputV); err != nil {
+		placeholder := s.newPlaceholder(originalV, err.Error())
+		return marshaledValue{Placeholder: &placeholder}, nil
+	}
+
+	if kind == jsonMarshaler {
+		return marshaledValue{Value: outputV.Bytes()}, nil
+	}
+
+	value, err := json.Marshal(outputV.Interface())
+	if err != nil {
+		return marshaledValue{}, fmt.Errorf("encodeToMarshaledValue(): %w", err)
+	}
+
+	return marshaledValue{Value: value}, nil
+}
+
+// Decodes the value using its unmarshaler and writes it to decodedV.
+func (s *JSONDecoder) decodeWithMarshaler(kind marshalerKind, encodedV, decodedV reflect.Value) error {
+	// With placeholders, the output of the marshaler is stored in a
+	// marshaledValue.
+	if encodedV.Type() == marshaledValueType {
+		mv := encodedV.Interface().(marshaledValue)
+		if mv.Placeholder != nil {
+			return s.decodeFromPlaceholder(reflect.ValueOf(*mv.Placeholder))
+		}
+
+		outputPtrV := reflect.New(marshaledTypeFor(kind))
+		if err := json.Unmarshal(mv.Value, outputPtrV.Interface()); err != nil {
+			return fmt.Errorf("decodeWithMarshaler(): %w", err)
+		}
+		encodedV = outputPtrV.Elem()
+	}
+
+	ptr := decodedV.Addr().Interface()
+
+	switch kind {
+	case jsonMarshaler:
+		// We use the standard json.Unmarshal function, so we'll invoke the
+		// json.Unmarshaler or encoding.TextUnmarshaler, if defined.
+		encodedMessage := encodedV.Interface().(json.RawMessage)
+		if err := json.Unmarshal(encodedMessage, ptr); err != nil {
+			return fmt.Errorf("decodeWithMarshaler(): failed to unmarshal to type %v, raw message: %s, err: %w",
+				decodedV.Type(), string(encodedMessage), err,
+			)
+		}
+
+	case binaryMarshaler:
+		if err := ptr.(encoding.BinaryUnmarshaler).UnmarshalBinary(encodedV.Bytes()); err != nil {
+			return fmt.Errorf("decodeWithMarshaler(): UnmarshalBinary for %v failed: %w", decodedV.Type(), err)
+		}
+
+	default:
+		return fmt.Errorf("decodeWithMarshaler(): %v does not have an unmarshaler", decodedV.Type())
+	}
+
+	return nil
+}
+
+// Returns the JSON key for the text of a map key; see isTextMapKey.
+func marshalTextKey(keyV reflect.Value) (string, error) {
+	text, err := ensureAddressable(keyV).Addr().Interface().(encoding.TextMarshaler).MarshalText()
+	if err != nil {
+		return "", fmt.Errorf("marshalTextKey(): MarshalText for %v failed: %w", keyV.Type(), err)
+	}
+
+	// The text may contain invalid UTF-8; see escapeMapKey.
+	return escapeMapKey(string(text)), nil
+}
+
+// Returns the map key of the type for the text; see isTextMapKey.
+func unmarshalTextKey(keyT reflect.Type, key string) (reflect.Value, error) {
+	text, err := unescapeMapKey(key)
+	if err != nil {
+		return zeroValue, fmt.Errorf("unmarshalTextKey(): %w", err)
+	}
+
+	keyPtrV := reflect.New(keyT)
+	if err := keyPtrV.Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(text)); err != nil {
+		return zeroValue, fmt.Errorf("unmarshalTextKey(): UnmarshalText for %v failed: %w", keyT, err)
+	}
+
+	return keyPtrV.Elem(), nil
+}
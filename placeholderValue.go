@@ -0,0 +1,148 @@
+package unsafely
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// The type used to represent unsupported values in encoded structs when using
+// WithPlaceholders.
+var placeholderValueType = reflect.TypeFor[Placeholder]()
+
+// Returns true if the provided type is a Placeholder.
+func isPlaceholderValueType(t reflect.Type) bool {
+	return t == placeholderValueType
+}
+
+// Placeholder describes an unsupported value that was replaced by a
+// placeholder; see WithPlaceholders.
+type Placeholder struct {
+	// Kind is the kind of the value, e.g, "unsafe.Pointer".
+	Kind string `json:"kind"`
+
+	// Type is the type string of the value.
+	Type string `json:"type"`
+
+	// Path is the Go path of the value, e.g, "value.items[3].callback".
+	Path string `json:"path"`
+
+	// Reason is the reason the value is unsupported.
+	Reason string `json:"reason"`
+}
+
+// Encodes the unsupported value to a Placeholder, and adds it to the
+// encoder's placeholders.
+func (s *JSONEncoder) encodeToPlaceholder(inV reflect.Value) (reflect.Value, error) {
+	// Find the reason the value is unsupported.
+	options := s.config.encoding
+	options.Placeholders = false
+
+	reason := "unsupported value"
+	if _, err := encodedTypeFor(options, inV.Type()); err != nil {
+		reason = err.Error()
+	}
+
+	return reflect.ValueOf(s.newPlaceholder(inV, reason)), nil
+}
+
+// Returns a Placeholder for the value that could not be encoded, and adds it
+// to the encoder's placeholders.
+func (s *JSONEncoder) newPlaceholder(inV reflect.Value, reason string) Placeholder {
+	placeholder := Placeholder{
+		Kind:   inV.Kind().String(),
+		Type:   inV.Type().String(),
+		Path:   s.goPath.String(),
+		Reason: reason,
+	}
+
+	if !s.dryRun {
+		s.placeholders = append(s.placeholders, placeholder)
+	}
+
+	return placeholder
+}
+
+// Placeholders returns the unsupported values that were replaced by
+// placeholders in the last call to Encode; see WithPlaceholders.
+func (s *JSONEncoder) Placeholders() []Placeholder {
+	return s.placeholders
+}
+
+// Decodes a Placeholder, leaving the decoded value as the zero value if
+// WithPlaceholdersAsZero is set.
+func (s *JSONDecoder) decodeFromPlaceholder(encodedV reflect.Value) error {
+	placeholder, ok := encodedV.Interface().(Placeholder)
+	if !ok {
+		return fmt.Errorf(
+			"decodeFromPlaceholder: expected encodedV to be a Placeholder; received %T",
+			encodedV.Interface(),
+		)
+	}
+
+	if !s.config.placeholdersAsZero {
+		return fmt.Errorf(
+			"decodeFromPlaceholder: %s at %s was not encoded (%s); use WithPlaceholdersAsZero to leave it as the zero value",
+			placeholder.Type, placeholder.Path, placeholder.Reason,
+		)
+	}
+
+	return nil
+}
+
+// Returns the Go path element for a map key, e.g, `["key"]`. Keys that aren't
+// primitives are elided.
+func mapKeyPath(key reflect.Value) string {
+	switch {
+	case key.Kind() == reflect.String:
+		return "[" + strconv.Quote(key.String()) + "]"
+	case isSimplePrimitive(key.Kind()):
+		return fmt.Sprintf("[%v]", key)
+	default:
+		return "[...]"
+	}
+}
+
+// Tracks the Go path of the value being encoded, e.g, "value.items[3]".
+//
+// The methods of a nil *goPath do nothing, so the path is only tracked when
+// needed.
+type goPath struct {
+	elems []string
+}
+
+// Adds an element to the path, e.g, ".field" or "[3]".
+func (p *goPath) push(elem string) {
+	if p != nil {
+		p.elems = append(p.elems, elem)
+	}
+}
+
+// Adds an index to the path.
+func (p *goPath) pushIndex(i int) {
+	if p != nil {
+		p.push("[" + strconv.Itoa(i) + "]")
+	}
+}
+
+// Removes the last element from the path.
+func (p *goPath) pop() {
+	if p != nil {
+		p.elems = p.elems[:len(p.elems)-1]
+	}
+}
+
+// Removes all elements from the path.
+func (p *goPath) reset() {
+	if p != nil {
+		p.elems = p.elems[:0]
+	}
+}
+
+func (p *goPath) String() string {
+	if p == nil {
+		return ""
+	}
+	return "value" + strings.Join(p.elems, "")
+}
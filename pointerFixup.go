@@ -0,0 +1,153 @@
+package unsafely
+
+import (
+	"cmp"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// A pointer that could not be set yet, because it refers to a pointer value
+// that has not been decoded.
+type pointerFixup struct {
+	// The settable pointer that should be set once the value is decoded.
+	target reflect.Value
+
+	// The path in the decoded value that the target points to, if any.
+	path string
+
+	// The offset in the decoded value that the target points to, if the target
+	// is an unsafe.Pointer.
+	offset uintptr
+
+	// Functions to run after the target is set, e.g, to copy a temporary value
+	// containing the target to its final location.
+	onResolve []func()
+}
+
+// Defers setting the pointer in outPtrV until the pointer value with the given
+// ID is decoded.
+func (s *JSONDecoder) addFixup(pointer pointerID, path string, outPtrV reflect.Value) {
+	fixup := &pointerFixup{target: outPtrV, path: path}
+	s.unresolved[pointer] = append(s.unresolved[pointer], fixup)
+	s.fixupLog = append(s.fixupLog, fixup)
+}
+
+// Defers setting the unsafe pointer in outV until the pointer value with the
+// given ID is decoded.
+func (s *JSONDecoder) addOffsetFixup(pointer pointerID, offset uintptr, outV reflect.Value) {
+	fixup := &pointerFixup{target: outV, offset: offset}
+	s.unresolved[pointer] = append(s.unresolved[pointer], fixup)
+	s.fixupLog = append(s.fixupLog, fixup)
+}
+
+// Stores the decoded pointer for the ID and sets any pointers that were
+// waiting for it.
+func (s *JSONDecoder) storePointer(pointer pointerID, ptrV reflect.Value) error {
+	s.pointerValues[pointer] = ptrV
+
+	fixups := s.unresolved[pointer]
+	delete(s.unresolved, pointer)
+
+	for _, fixup := range fixups {
+		if fixup.target.Kind() == reflect.UnsafePointer {
+			setUnsafePointer(fixup.target, ptrV, fixup.offset)
+		} else if err := setPointer(fixup.target, ptrV, pointer, fixup.path); err != nil {
+			return err
+		}
+
+		for _, fn := range fixup.onResolve {
+			fn()
+		}
+	}
+
+	return nil
+}
+
+// Runs the decode function, which decodes into a temporary value, then
+// registers onResolve for any fixups created during decoding. This allows the
+// caller to copy the temporary value again once its pointers are set, e.g, for
+// map entries and interface values.
+func (s *JSONDecoder) watchFixups(decode func() error, onResolve func()) error {
+	start := len(s.fixupLog)
+	if err := decode(); err != nil {
+		return err
+	}
+
+	for _, fixup := range s.fixupLog[start:] {
+		fixup.onResolve = append(fixup.onResolve, onResolve)
+	}
+
+	return nil
+}
+
+// UnresolvedPointers returns the IDs of pointers that have been referenced, but
+// whose values have not been decoded yet.
+//
+// The IDs are strings as they appear in the JSON, e.g, "1" for reference
+// numbers, or "#/value/a" using PathPointerIDs. Reference numbers are sorted
+// numerically, before other IDs.
+//
+// This is only expected to be non-empty if the JSON was encoded using
+// WithPointerReferences, and the JSON containing the pointer values has not
+// been decoded yet.
+func (s *JSONDecoder) UnresolvedPointers() []string {
+	pointers := make([]pointerID, 0, len(s.unresolved))
+	for pointer := range s.unresolved {
+		pointers = append(pointers, pointer)
+	}
+
+	slices.SortFunc(pointers, comparePointerIDs)
+
+	ids := make([]string, len(pointers))
+	for i, pointer := range pointers {
+		ids[i] = string(pointer)
+	}
+
+	return ids
+}
+
+// Orders reference numbers numerically, before other pointer IDs. Reference
+// numbers don't have leading zeros, so shorter numbers are smaller.
+func comparePointerIDs(a, b pointerID) int {
+	switch aNum, bNum := a.isNumber(), b.isNumber(); {
+	case aNum && bNum:
+		return cmp.Or(cmp.Compare(len(a), len(b)), strings.Compare(string(a), string(b)))
+	case aNum != bNum:
+		if aNum {
+			return -1
+		}
+		return 1
+	default:
+		return strings.Compare(string(a), string(b))
+	}
+}
+
+// Sets the pointer in outPtrV to the decoded pointer, or to the value at the
+// path in the decoded pointer's value, checking that the types are compatible.
+func setPointer(outPtrV, ptrV reflect.Value, pointer pointerID, path string) error {
+	if path != "" {
+		var err error
+		ptrV, err = pointerAtPath(ptrV, path, outPtrV.Type())
+		if err != nil {
+			return fmt.Errorf("setPointer(): pointer %s: %w", pointer, err)
+		}
+	}
+
+	// Channels are stored as bidirectional channels, which may be converted to
+	// directional or named channel types.
+	if ptrV.Kind() == reflect.Chan && ptrV.Type() != outPtrV.Type() && ptrV.Type().ConvertibleTo(outPtrV.Type()) {
+		ptrV = ptrV.Convert(outPtrV.Type())
+	}
+
+	if ptrV.Type() != outPtrV.Type() {
+		return fmt.Errorf(
+			"setPointer(): pointer %s%s has type %v; expected %v",
+			pointer, path, ptrV.Type(), outPtrV.Type(),
+		)
+	}
+
+	setField(outPtrV, ptrV)
+	return nil
+}
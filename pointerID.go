@@ -0,0 +1,431 @@
+package unsafely
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Identifies a pointer in a pointerValue.
+//
+// By default, pointer IDs are reference numbers, which are marshaled as JSON
+// numbers. Other IDs (see WithPointerIDs) are marshaled as JSON strings.
+type pointerID string
+
+// Returns the pointer ID for a reference number.
+func newPointerID(index int) pointerID {
+	return pointerID(strconv.Itoa(index))
+}
+
+// Returns true if the pointer ID is a reference number.
+func (id pointerID) isNumber() bool {
+	_, err := strconv.ParseUint(string(id), 10, 64)
+	return err == nil
+}
+
+// MarshalJSON implements json.Marshaler.
+func (id pointerID) MarshalJSON() ([]byte, error) {
+	if id.isNumber() {
+		return []byte(id), nil
+	}
+	return json.Marshal(string(id))
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (id *pointerID) UnmarshalJSON(b []byte) error {
+	if len(b) > 0 && b[0] == '"' {
+		var s string
+		if err := json.Unmarshal(b, &s); err != nil {
+			return err
+		}
+
+		*id = pointerID(s)
+		return nil
+	}
+
+	var n json.Number
+	if err := json.Unmarshal(b, &n); err != nil {
+		return fmt.Errorf("pointerID.UnmarshalJSON(): %w", err)
+	}
+
+	*id = pointerID(n)
+	return nil
+}
+
+// PointerIDs determines how pointer IDs are assigned when encoding.
+type PointerIDs int
+
+const (
+	// PostOrderPointerIDs numbers pointers after their underlying values are
+	// encoded, so pointers nested in other pointers have lower numbers. This is
+	// the default.
+	PostOrderPointerIDs PointerIDs = iota
+
+	// PreOrderPointerIDs numbers pointers in the order that they first appear in
+	// the output.
+	PreOrderPointerIDs
+
+	// PathPointerIDs uses the JSON path at which a pointer first appears in the
+	// output as the pointer ID, e.g, "#/value/items/3".
+	//
+	// Non-primitive map keys are stored as JSON strings, so the paths of pointers
+	// that first appear in these keys continue from the map's path with "$keys"
+	// and the key, e.g, "#/value/m/$keys/{\"ptr\":{\"pointer\":1,\"value\":42}}/ptr".
+	// The pointer IDs in the key segment are numbered within the key, unless the
+	// pointers appeared earlier in the output.
+	//
+	// This keeps pointer IDs stable when unrelated values are added or removed.
+	PathPointerIDs
+)
+
+// CanonicalizePointerIDs rewrites the pointer IDs in JSON produced by
+// MarshalJSON or JSONEncoder.Encode to the IDs that would be produced using
+// PathPointerIDs.
+//
+// Pointers can't be told apart from other values by their JSON alone, so the
+// JSON is unmarshaled into outPtr, which must be a pointer to a value of the
+// marshaled type, and the value is marshaled again. The encoding options
+// recorded in the JSON are reused, and the options should be the other options
+// used to produce the JSON, e.g, WithIndent.
+//
+// The JSON is unmarshaled with the default options of UnmarshalJSON. Use a
+// PointerIDCanonicalizer to set other options, e.g, WithTypeResolver for
+// interface fields, or to canonicalize multiple documents produced by the same
+// JSONEncoder.
+func CanonicalizePointerIDs(b []byte, outPtr any, options ...MarshalJSONOption) ([]byte, error) {
+	return NewPointerIDCanonicalizer(NewJSONDecoder(), options...).Canonicalize(b, outPtr)
+}
+
+// PointerIDCanonicalizer rewrites the pointer IDs in JSON produced by a
+// JSONEncoder to the IDs that would be produced using PathPointerIDs; see
+// CanonicalizePointerIDs.
+//
+// If the same PointerIDCanonicalizer is used for multiple documents produced
+// by the same JSONEncoder, in the order that they were produced, references to
+// pointers in earlier documents are rewritten like the JSONEncoder would have
+// written them using PathPointerIDs.
+type PointerIDCanonicalizer struct {
+	decoder *JSONDecoder
+	options []MarshalJSONOption
+
+	// Created for the first document, using the encoding options recorded in it.
+	encoder        *JSONEncoder
+	encodedOptions encodingOptions
+}
+
+// NewPointerIDCanonicalizer creates a PointerIDCanonicalizer that unmarshals
+// documents with the decoder, and marshals them with the options, which should
+// be the options used to produce the documents other than those recorded in
+// them, e.g, WithIndent.
+func NewPointerIDCanonicalizer(decoder *JSONDecoder, options ...MarshalJSONOption) *PointerIDCanonicalizer {
+	return &PointerIDCanonicalizer{
+		decoder: decoder,
+		options: options,
+	}
+}
+
+// Canonicalize rewrites the pointer IDs in the document. The document is
+// unmarshaled into outPtr, which must be a pointer to a value of the marshaled
+// type, and the value is marshaled again.
+func (s *PointerIDCanonicalizer) Canonicalize(b []byte, outPtr any) ([]byte, error) {
+	var wrapper encodedJSONWrapper
+	if err := json.Unmarshal(b, &wrapper); err != nil {
+		return nil, fmt.Errorf("Canonicalize(): %w", err)
+	}
+
+	var encodedOptions encodingOptions
+	if wrapper.Options != nil {
+		encodedOptions = *wrapper.Options
+	}
+
+	if s.encoder == nil {
+		// The recorded encoding options are applied first, so these can be
+		// overridden by the options.
+		s.encoder = NewJSONEncoder(append(
+			[]MarshalJSONOption{func(config *marshalJSONConfig) {
+				config.encoding = encodedOptions
+			}},
+			append(s.options, WithPointerIDs(PathPointerIDs))...,
+		)...)
+		s.encodedOptions = encodedOptions
+	} else if encodedOptions != s.encodedOptions {
+		return nil, fmt.Errorf("Canonicalize(): the document was encoded with different options than earlier documents")
+	}
+
+	if err := s.decoder.Decode(b, outPtr); err != nil {
+		return nil, fmt.Errorf("Canonicalize(): %w", err)
+	}
+
+	if unresolved := s.decoder.UnresolvedPointers(); len(unresolved) > 0 {
+		return nil, fmt.Errorf("Canonicalize(): references to unknown pointers %q", unresolved)
+	}
+
+	// The unmarshaled value is encoded in place, so pointers into it are
+	// preserved.
+	out, err := s.encoder.encodeValue(reflect.ValueOf(outPtr).Elem())
+	if err != nil {
+		return nil, fmt.Errorf("Canonicalize(): %w", err)
+	}
+
+	return out, nil
+}
+
+// Rewrites pointer IDs in the order that they appear in JSON output.
+//
+// While encoding, pointers are given provisional IDs that contain a random
+// token, so only the pointers emitted by the encoder are rewritten, and not
+// other values with the same structure.
+type pointerIDRewriter struct {
+	mode PointerIDs
+
+	// The prefix of the provisional IDs.
+	token string
+
+	// Map from the original IDs to the rewritten IDs.
+	rewritten map[pointerID]pointerID
+
+	// The rewritten IDs that have been used.
+	used map[pointerID]struct{}
+}
+
+func newPointerIDRewriter(mode PointerIDs) *pointerIDRewriter {
+	return &pointerIDRewriter{
+		mode:      mode,
+		token:     fmt.Sprintf("unsafely:%016x:", rand.Uint64()),
+		rewritten: make(map[pointerID]pointerID),
+		used:      make(map[pointerID]struct{}),
+	}
+}
+
+// Returns the provisional ID for a reference number.
+func (s *pointerIDRewriter) provisionalID(index int) pointerID {
+	return pointerID(s.token + strconv.Itoa(index))
+}
+
+// Rewrites the pointer IDs in the JSON document, then formats it with the
+// prefix and indent.
+func (s *pointerIDRewriter) rewriteDocument(b []byte, prefix, indent string) ([]byte, error) {
+	root, err := parseJSONNode(b)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.rewrite(root, "#"); err != nil {
+		return nil, err
+	}
+
+	return root.format(prefix, indent)
+}
+
+// Rewrites the pointer IDs in the node, which is located at the JSON path.
+func (s *pointerIDRewriter) rewrite(node *jsonNode, path string) error {
+	switch node.kind {
+	case jsonObject:
+		if isPointerValueNode(node) {
+			idNode := node.get("pointer")
+
+			var id pointerID
+			if err := json.Unmarshal(idNode.raw, &id); err != nil {
+				return fmt.Errorf("rewrite(): invalid pointer ID at %s: %w", path, err)
+			}
+
+			// Other values with the same structure don't have provisional IDs.
+			if strings.HasPrefix(string(id), s.token) {
+				idBytes, err := json.Marshal(s.rewriteID(id, path))
+				if err != nil {
+					return fmt.Errorf("rewrite(): %w", err)
+				}
+				idNode.raw = idBytes
+			}
+		}
+
+		for i, key := range node.keys {
+			// Non-primitive map keys are stored as JSON strings, which may contain
+			// pointers.
+			if err := s.rewriteKey(node, i, path); err != nil {
+				return err
+			}
+
+			if err := s.rewrite(node.values[i], path+"/"+escapeJSONPointer(key)); err != nil {
+				return err
+			}
+		}
+
+	case jsonArray:
+		for i, elem := range node.elems {
+			if err := s.rewrite(elem, path+"/"+strconv.Itoa(i)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Rewrites the pointer IDs in an object key if it contains JSON. The key is
+// located at the path of the object, followed by "$keys" and the key; see
+// keySegment.
+func (s *pointerIDRewriter) rewriteKey(node *jsonNode, i int, objectPath string) error {
+	key := node.keys[i]
+	if !strings.HasPrefix(key, "{") && !strings.HasPrefix(key, "[") {
+		return nil
+	}
+
+	keyNode, err := parseJSONNode([]byte(key))
+	if err != nil {
+		return nil // not JSON
+	}
+
+	segment, err := s.keySegment(key)
+	if err != nil {
+		return fmt.Errorf("rewriteKey(): %w", err)
+	}
+
+	if err := s.rewrite(keyNode, objectPath+"/$keys/"+escapeJSONPointer(segment)); err != nil {
+		return err
+	}
+
+	keyBytes, err := keyNode.format("", "")
+	if err != nil {
+		return fmt.Errorf("rewriteKey(): %w", err)
+	}
+
+	node.keys[i] = string(keyBytes)
+	return nil
+}
+
+// Returns the path segment for an object key that contains JSON, which is the
+// key with its provisional pointer IDs replaced, so the segment doesn't depend
+// on the position of the key or on the random token. Pointers that were
+// rewritten before use their rewritten IDs, and other pointers are numbered in
+// the order that they appear in the key.
+func (s *pointerIDRewriter) keySegment(key string) (string, error) {
+	keyNode, err := parseJSONNode([]byte(key))
+	if err != nil {
+		return "", fmt.Errorf("keySegment(): %w", err)
+	}
+
+	if err := s.replaceProvisionalIDs(keyNode, make(map[pointerID]pointerID)); err != nil {
+		return "", err
+	}
+
+	b, err := keyNode.format("", "")
+	if err != nil {
+		return "", fmt.Errorf("keySegment(): %w", err)
+	}
+
+	return string(b), nil
+}
+
+// Replaces the provisional pointer IDs in the node for keySegment. The local
+// map holds the numbers of the pointers that weren't rewritten before.
+func (s *pointerIDRewriter) replaceProvisionalIDs(node *jsonNode, local map[pointerID]pointerID) error {
+	switch node.kind {
+	case jsonObject:
+		if isPointerValueNode(node) {
+			idNode := node.get("pointer")
+
+			var id pointerID
+			if err := json.Unmarshal(idNode.raw, &id); err != nil {
+				return fmt.Errorf("replaceProvisionalIDs(): %w", err)
+			}
+
+			if strings.HasPrefix(string(id), s.token) {
+				replaced, ok := s.rewritten[id]
+				if !ok {
+					if replaced, ok = local[id]; !ok {
+						replaced = newPointerID(len(local) + 1)
+						local[id] = replaced
+					}
+				}
+
+				idBytes, err := json.Marshal(replaced)
+				if err != nil {
+					return fmt.Errorf("replaceProvisionalIDs(): %w", err)
+				}
+				idNode.raw = idBytes
+			}
+		}
+
+		for _, value := range node.values {
+			if err := s.replaceProvisionalIDs(value, local); err != nil {
+				return err
+			}
+		}
+
+	case jsonArray:
+		for _, elem := range node.elems {
+			if err := s.replaceProvisionalIDs(elem, local); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Returns the rewritten ID for the pointer ID, which first appears at the path
+// if it hasn't been rewritten before.
+func (s *pointerIDRewriter) rewriteID(id pointerID, path string) pointerID {
+	if rewritten, ok := s.rewritten[id]; ok {
+		return rewritten
+	}
+
+	var rewritten pointerID
+	switch s.mode {
+	case PreOrderPointerIDs:
+		rewritten = newPointerID(len(s.rewritten) + 1)
+	default:
+		rewritten = pointerID(path)
+	}
+
+	// Paths may be reused by later documents encoded with the same JSONEncoder.
+	if _, ok := s.used[rewritten]; ok {
+		for i := 2; ; i++ {
+			candidate := pointerID(fmt.Sprintf("%s@%d", rewritten, i))
+			if _, ok := s.used[candidate]; !ok {
+				rewritten = candidate
+				break
+			}
+		}
+	}
+
+	s.rewritten[id] = rewritten
+	s.used[rewritten] = struct{}{}
+	return rewritten
+}
+
+// Returns true if the JSON object looks like a pointerValue.
+func isPointerValueNode(node *jsonNode) bool {
+	idNode := node.get("pointer")
+	if idNode == nil || idNode.kind != jsonScalar || !isPointerIDJSON(idNode.raw) {
+		return false
+	}
+
+	for _, key := range node.keys {
+		if !isPointerValueKey(key) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Returns true if the JSON could be a pointer ID, i.e, a number or a string.
+func isPointerIDJSON(b []byte) bool {
+	return len(b) > 0 && (b[0] == '"' || (b[0] >= '0' && b[0] <= '9'))
+}
+
+// Returns true if the key is a JSON key of a pointerValue, or of an
+// unsafePointerValue that refers to a pointer.
+func isPointerValueKey(key string) bool {
+	return key == "pointer" || key == "path" || key == "value" || key == "offset"
+}
+
+// Escapes a JSON object key for use in a JSON pointer (RFC 6901).
+func escapeJSONPointer(key string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(key)
+}
@@ -0,0 +1,358 @@
+package unsafely
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"unsafe"
+)
+
+// Map from types to whether their values may contain references, which
+// depends on the options; see mayHaveReferences.
+var referenceTypes = make(map[typeCacheKey]bool)
+
+// Returns true if values of the type may contain pointers or other references
+// to memory that is tracked by pointerRegions, e.g, channels, interfaces, or
+// slices with WithSliceAliasing. Values of other types don't need to be
+// traversed to collect the pointer regions.
+func mayHaveReferences(options encodingOptions, t reflect.Type) bool {
+	key := typeCacheKey{options: options, inputT: t}
+	if has, ok := referenceTypes[key]; ok {
+		return has
+	}
+
+	// Recursive types are assumed to have references while they are checked.
+	referenceTypes[key] = true
+
+	var has bool
+	if c, ok := codecFor(t); ok {
+		has = !c.leaf
+	} else if marshalerKindFor(options, t) == noMarshaler {
+		switch t.Kind() {
+		case reflect.Pointer, reflect.Interface, reflect.Chan, reflect.UnsafePointer:
+			has = true
+		case reflect.Slice:
+			has = options.SliceAliasing || mayHaveReferences(options, t.Elem())
+		case reflect.Array:
+			has = mayHaveReferences(options, t.Elem())
+		case reflect.Map:
+			has = mayHaveReferences(options, t.Key()) || mayHaveReferences(options, t.Elem())
+		case reflect.Struct:
+			for i := range t.NumField() {
+				if mayHaveReferences(options, t.Field(i).Type) {
+					has = true
+					break
+				}
+			}
+		}
+	}
+
+	referenceTypes[key] = has
+	return has
+}
+
+// Identifies a pointer by its address and element type.
+//
+// The address alone is not sufficient, since a pointer to a struct and a
+// pointer to its first field have the same address.
+type pointerKey struct {
+	ptr   unsafe.Pointer
+	elemT reflect.Type
+}
+
+// The memory referenced by a pointer.
+type pointerRegion struct {
+	key        pointerKey
+	start, end uintptr
+}
+
+// Tracks the memory referenced by pointers, so we can find pointers that
+// point into the values of other pointers, e.g, a pointer to a struct field.
+//
+// This also counts the references to each pointer in the current call to
+// Encode, so we can find pointers that are shared.
+type pointerRegions struct {
+	// The pointers whose memory is tracked, from all calls to Encode.
+	regions map[pointerKey]struct{}
+
+	// Map from pointers to the number of references to them in the current call
+	// to Encode; see resetCounts.
+	counts map[pointerKey]int
+
+	// The regions that are not contained in other regions, sorted by address.
+	// Computed lazily.
+	outermost []pointerRegion
+	dirty     bool
+
+	// Outermost regions that contain other regions, or addresses referenced by
+	// unsafe pointers. Computed lazily.
+	containers map[pointerKey]struct{}
+
+	// Addresses referenced by unsafe pointers; see WithUnsafePointers.
+	unsafeRefs []uintptr
+}
+
+func newPointerRegions() *pointerRegions {
+	return &pointerRegions{
+		regions: make(map[pointerKey]struct{}),
+		counts:  make(map[pointerKey]int),
+	}
+}
+
+// Adds a reference to the memory referenced by the pointer.
+func (s *pointerRegions) add(key pointerKey) {
+	if _, ok := s.regions[key]; !ok {
+		s.regions[key] = struct{}{}
+		s.dirty = true
+	}
+	s.counts[key]++
+}
+
+// Clears the reference counts before the next call to Encode. The regions are
+// kept, so later values can refer into the values of earlier pointers.
+func (s *pointerRegions) resetCounts() {
+	clear(s.counts)
+}
+
+// Adds a reference to an address from an unsafe pointer.
+func (s *pointerRegions) addUnsafe(addr uintptr) {
+	s.unsafeRefs = append(s.unsafeRefs, addr)
+	s.dirty = true
+}
+
+// Returns true if the pointer is referenced more than once in the current call
+// to Encode, or if other pointers may point into its value.
+func (s *pointerRegions) isShared(key pointerKey) bool {
+	if s.counts[key] > 1 {
+		return true
+	}
+
+	if s.dirty {
+		s.computeOutermost()
+	}
+
+	_, isContainer := s.containers[key]
+	return isContainer
+}
+
+// Returns the outermost pointer whose value contains the pointer's value, and
+// the path from that value to the pointer's value.
+//
+// Returns false if the pointer is the outermost pointer, or if the pointer is
+// not contained in the values of any other pointers.
+func (s *pointerRegions) findContainer(key pointerKey) (pointerKey, string, bool) {
+	if s.dirty {
+		s.computeOutermost()
+	}
+
+	var (
+		start = uintptr(key.ptr)
+		end   = start + key.elemT.Size()
+	)
+
+	container, ok := s.outermostAt(start)
+	if !ok || container.key == key || end > container.end {
+		return pointerKey{}, "", false
+	}
+
+	path, ok := pathTo(container.key.elemT, start-container.start, key.elemT)
+	if !ok {
+		return pointerKey{}, "", false
+	}
+
+	return container.key, path, true
+}
+
+// Returns the outermost pointer whose value contains the address, and the
+// offset of the address in that value.
+func (s *pointerRegions) findAddress(addr uintptr) (pointerKey, uintptr, bool) {
+	if s.dirty {
+		s.computeOutermost()
+	}
+
+	container, ok := s.outermostAt(addr)
+	if !ok || addr >= container.end {
+		return pointerKey{}, 0, false
+	}
+
+	return container.key, addr - container.start, true
+}
+
+// Returns the last outermost region starting at or before the address.
+func (s *pointerRegions) outermostAt(addr uintptr) (pointerRegion, bool) {
+	i, found := slices.BinarySearchFunc(s.outermost, addr, func(r pointerRegion, addr uintptr) int {
+		switch {
+		case r.start < addr:
+			return -1
+		case r.start > addr:
+			return 1
+		default:
+			return 0
+		}
+	})
+	if !found {
+		i--
+	}
+	if i < 0 {
+		return pointerRegion{}, false
+	}
+
+	return s.outermost[i], true
+}
+
+// Computes the regions that are not contained in other regions.
+func (s *pointerRegions) computeOutermost() {
+	all := make([]pointerRegion, 0, len(s.regions))
+	for key := range s.regions {
+		start := uintptr(key.ptr)
+		all = append(all, pointerRegion{key: key, start: start, end: start + key.elemT.Size()})
+	}
+
+	// Sort by address, with larger regions first.
+	slices.SortFunc(all, func(a, b pointerRegion) int {
+		if a.start != b.start {
+			if a.start < b.start {
+				return -1
+			}
+			return 1
+		}
+
+		if a.end != b.end {
+			if a.end > b.end {
+				return -1
+			}
+			return 1
+		}
+
+		// If the bounds are the same, one value may contain the other, e.g, a
+		// struct with a single field. Otherwise, order them consistently.
+		if _, ok := pathTo(a.key.elemT, 0, b.key.elemT); ok {
+			return -1
+		}
+		if _, ok := pathTo(b.key.elemT, 0, a.key.elemT); ok {
+			return 1
+		}
+		return strings.Compare(a.key.elemT.String(), b.key.elemT.String())
+	})
+
+	s.outermost = s.outermost[:0]
+	s.containers = make(map[pointerKey]struct{})
+	for _, region := range all {
+		if n := len(s.outermost); n > 0 && region.end <= s.outermost[n-1].end {
+			// Contained in the previous region.
+			s.containers[s.outermost[n-1].key] = struct{}{}
+			continue
+		}
+		s.outermost = append(s.outermost, region)
+	}
+
+	// Values referenced by unsafe pointers need an ID, so they are treated like
+	// containers.
+	for _, addr := range s.unsafeRefs {
+		if region, ok := s.outermostAt(addr); ok && addr < region.end {
+			s.containers[region.key] = struct{}{}
+		}
+	}
+
+	s.dirty = false
+}
+
+// Returns the path of struct field names and array indices from a value of
+// type fromT to a value of type toT at the offset.
+func pathTo(fromT reflect.Type, offset uintptr, toT reflect.Type) (string, bool) {
+	if offset == 0 && fromT == toT {
+		return "", true
+	}
+
+	switch fromT.Kind() {
+	case reflect.Struct:
+		for i := range fromT.NumField() {
+			field := fromT.Field(i)
+			if offset < field.Offset || offset >= field.Offset+field.Type.Size() {
+				continue
+			}
+
+			if path, ok := pathTo(field.Type, offset-field.Offset, toT); ok {
+				return "/" + field.Name + path, true
+			}
+		}
+
+	case reflect.Array:
+		elemSize := fromT.Elem().Size()
+		if elemSize == 0 {
+			return "", false
+		}
+
+		index := offset / elemSize
+		if path, ok := pathTo(fromT.Elem(), offset%elemSize, toT); ok {
+			return "/" + strconv.FormatUint(uint64(index), 10) + path, true
+		}
+
+		// An array of the same element type may point into the array, e.g, for
+		// the backing array of a slice of another slice. The path refers to the
+		// first element.
+		if toT.Kind() == reflect.Array && toT.Elem() == fromT.Elem() &&
+			offset%elemSize == 0 && index+uintptr(toT.Len()) <= uintptr(fromT.Len()) {
+			return "/" + strconv.FormatUint(uint64(index), 10), true
+		}
+	}
+
+	return "", false
+}
+
+// Returns a pointer of type outT to the value at the path in the value
+// referenced by ptrV.
+//
+// If outT is a pointer to an array, and the path refers to an element of an
+// array with the same element type, the pointer points to the array starting at
+// that element.
+func pointerAtPath(ptrV reflect.Value, path string, outT reflect.Type) (reflect.Value, error) {
+	var (
+		v = ptrV.Elem()
+
+		// The array containing v, and the index of v, if any.
+		parentArrayV reflect.Value
+		index        int
+	)
+
+	for _, elem := range strings.Split(strings.TrimPrefix(path, "/"), "/") {
+		parentArrayV = zeroValue
+
+		switch v.Kind() {
+		case reflect.Struct:
+			field, ok := v.Type().FieldByName(elem)
+			if !ok || len(field.Index) != 1 {
+				return zeroValue, fmt.Errorf("pointerAtPath(): no field %q in %v", elem, v.Type())
+			}
+			v = getField(v.Field(field.Index[0]))
+
+		case reflect.Array:
+			var err error
+			index, err = strconv.Atoi(elem)
+			if err != nil || index < 0 || index >= v.Len() {
+				return zeroValue, fmt.Errorf("pointerAtPath(): invalid index %q for %v", elem, v.Type())
+			}
+			parentArrayV, v = v, v.Index(index)
+
+		default:
+			return zeroValue, fmt.Errorf("pointerAtPath(): unexpected kind %v in path %q", v.Kind(), path)
+		}
+	}
+
+	outElemT := outT.Elem()
+	if parentArrayV.IsValid() && outElemT.Kind() == reflect.Array &&
+		outElemT != v.Type() && outElemT.Elem() == v.Type() {
+		if index+outElemT.Len() > parentArrayV.Len() {
+			return zeroValue, fmt.Errorf(
+				"pointerAtPath(): %v at index %d exceeds the length of %v",
+				outElemT, index, parentArrayV.Type(),
+			)
+		}
+
+		return reflect.NewAt(outElemT, v.Addr().UnsafePointer()), nil
+	}
+
+	return v.Addr(), nil
+}
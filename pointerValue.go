@@ -18,21 +18,91 @@ func isPointerValueType(t reflect.Type) bool {
 
 // Represents a pointer stored in a field.
 type pointerValue struct {
-	// An integer indicating a reference number for a pointer. All pointerValue
-	// objects with the same pointer number represent the same pointer.
-	Pointer int `json:"pointer"`
+	// An ID for the pointer, usually a reference number. All pointerValue
+	// objects with the same pointer ID represent the same pointer.
+	Pointer pointerID `json:"pointer"`
+
+	// If set, the pointer points into the underlying value of the pointer with
+	// the ID, e.g, to a struct field or array element. The path
+	// is a "/"-separated list of field names and array indices.
+	Path string `json:"path,omitempty"`
 
 	// The JSON representation of the underlying value; null if the pointer is
 	// nil.
+	//
+	// The value is omitted for references to pointers whose value is stored
+	// elsewhere, i.e:
+	// - back-references to a pointer that is encountered again while its
+	//   underlying value is still being encoded, e.g, for doubly linked lists.
+	// - repeated pointers, if WithPointerReferences is set.
+	// - pointers with a Path.
 	Value json.RawMessage `json:"value,omitempty"`
+
+	// If set, the pointer refers to the well-known instance with the name, and
+	// only the name is marshaled; see WithWellKnown.
+	wellKnown string
+
+	// If set, only the Value is marshaled; see WithInlinePointers.
+	inline bool
+}
+
+// MarshalJSON implements json.Marshaler.
+func (pv pointerValue) MarshalJSON() ([]byte, error) {
+	if pv.inline {
+		return pv.Value, nil
+	}
+
+	if pv.wellKnown != "" {
+		return json.Marshal(wellKnownValue{WellKnown: pv.wellKnown})
+	}
+
+	type annotated pointerValue
+	return json.Marshal(annotated(pv))
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+//
+// The JSON may either be a pointerValue object, a reference to a well-known
+// instance, or the underlying value of a pointer that was inlined; see
+// WithInlinePointers.
+func (pv *pointerValue) UnmarshalJSON(b []byte) error {
+	if isWellKnownJSON(b) {
+		var wv wellKnownValue
+		if err := json.Unmarshal(b, &wv); err != nil {
+			return err
+		}
+
+		*pv = pointerValue{wellKnown: wv.WellKnown}
+		return nil
+	}
+
+	if !isPointerValueJSON(b) {
+		*pv = pointerValue{Value: append(json.RawMessage(nil), b...), inline: true}
+		return nil
+	}
+
+	type annotated pointerValue
+	return json.Unmarshal(b, (*annotated)(pv))
+}
+
+// Returns true if the JSON is an object with a "pointer" key containing a
+// number or string, and no keys other than those in a pointerValue.
+func isPointerValueJSON(b []byte) bool {
+	fields, ok := objectFields(b, isPointerValueKey)
+	id, hasID := fields["pointer"]
+	return ok && hasID && isPointerIDJSON(id)
 }
 
 // Encodes the value to a pointerValue object.
 //
 // The underlying value is marshaled and stored as JSON.
 //
-// If the pointer has been seen before, a encodeTo of the existing pointerValue
-// object may be returned, rather than re-marshaling the underlying value.
+// If the pointer has been seen before, a copy of the existing pointerValue
+// object may be returned, rather than re-marshaling the underlying value. If
+// WithPointerReferences is set, the copy only contains the reference number.
+//
+// If the pointer points into a value referenced by another pointer, e.g, a
+// struct field, the pointerValue refers to the path in the other value.
 func (s *JSONEncoder) encodeToPointerValue(inV reflect.Value) (out reflect.Value, err error) {
 	if inV.Kind() != reflect.Pointer {
 		return reflect.Value{}, fmt.Errorf(
@@ -44,6 +114,7 @@ func (s *JSONEncoder) encodeToPointerValue(inV reflect.Value) (out reflect.Value
 		zeroPointer unsafe.Pointer
 		inPtr       = inV.UnsafePointer()
 		isNil       = inV.IsNil()
+		key         = pointerKey{ptr: inPtr, elemT: inV.Type().Elem()}
 	)
 
 	// The expectation is that we only see zero pointers iff the input is nil.
@@ -54,53 +125,200 @@ func (s *JSONEncoder) encodeToPointerValue(inV reflect.Value) (out reflect.Value
 		)
 	}
 
+	if name, ok := s.config.wellKnown.nameOf(inV); ok {
+		return reflect.ValueOf(pointerValue{wellKnown: name}), nil
+	}
+
+	return s.encodeToReference(key, isNil, func() (reflect.Value, error) {
+		outV, err := s.encode(inV.Elem())
+		if err != nil {
+			return zeroValue, err
+		}
+
+		// An inlined nil pointer is null, which would make this pointer look nil
+		// too, so the nil pointer is annotated instead; see canInline.
+		if pv, ok := outV.Interface().(pointerValue); ok && pv.inline && isNullJSON(pv.Value) {
+			outV = reflect.ValueOf(pointerValue{
+				Pointer: s.nextPointerID(),
+				Value:   pv.Value,
+			})
+		}
+
+		return outV, nil
+	})
+}
+
+// Encodes a reference to the value identified by the key, e.g, the underlying
+// value of a pointer, to a pointerValue object. The encodeElem function returns
+// the encoded value, and is only called if the value needs to be marshaled.
+func (s *JSONEncoder) encodeToReference(
+	key pointerKey,
+	isNil bool,
+	encodeElem func() (reflect.Value, error),
+) (reflect.Value, error) {
+	// Pointers to zero-sized values may share the same address (e.g, all
+	// pointers to struct{}), so these are not tracked.
+	isTracked := !isNil && key.elemT.Size() > 0
+
+	// Shallow sort keys don't include the values of nested pointers; see
+	// sortKeyFor.
+	if s.shallow && s.referenceDepth > 0 {
+		return reflect.ValueOf(pointerValue{}), nil
+	}
+
 	// Marshal the underlying type; default to null.
 	var value = json.RawMessage("null")
 
-	if !isNil {
+	if isTracked {
+		// Count the references to each pointer when collecting pointer regions.
+		if s.dryRun {
+			s.pointerRegions.add(key)
+		}
+
+		// If the pointer points into the value of another pointer, refer to the
+		// other pointer instead.
+		if !s.dryRun {
+			if container, path, ok := s.pointerRegions.findContainer(key); ok {
+				return reflect.ValueOf(pointerValue{
+					Pointer: s.reservePointerID(container),
+					Path:    path,
+				}), nil
+			}
+		}
+
 		// Store pointers that we've seen so we don't need to remarshal them later.
-		if val, ok := s.pointerValues[inPtr]; ok {
+		if val, ok := s.pointerValues[key]; ok {
+			if s.config.pointerReferences {
+				return reflect.ValueOf(pointerValue{Pointer: val.Interface().(pointerValue).Pointer}), nil
+			}
 			return val, nil
 		}
 
-		// Track the pointers that we're processing to ensure we don't have any data
-		// cycles.
-		if _, pending := s.pendingPointers[inPtr]; pending {
-			return reflect.Value{}, fmt.Errorf(
-				"encodeToPointerValue: cycle detected; structs with cyclic data are not supported",
-			)
+		// If we're already processing this pointer, we've found a cycle. Return a
+		// back-reference without a value.
+		if _, pending := s.pendingPointers[key]; pending {
+			return reflect.ValueOf(pointerValue{Pointer: s.reservePointerID(key)}), nil
 		}
-		s.pendingPointers[inPtr] = struct{}{}
+		s.pendingPointers[key] = struct{}{}
 
-		// Encode the underlying value.
-		outV, err := s.encode(inV.Elem())
+		// Encode the underlying value. We're done processing this pointer
+		// afterwards, even if encoding failed, so stop tracking it.
+		outV, err := s.encodeReferenced(encodeElem)
+		delete(s.pendingPointers, key)
 		if err != nil {
-			return reflect.Value{}, fmt.Errorf("encodeToPointerValue: %w", err)
+			return reflect.Value{}, fmt.Errorf("encodeToReference: %w", err)
 		}
 
-		// We're done processing this pointer, so stop tracking it.
-		delete(s.pendingPointers, inPtr)
+		value, err = s.jsonMarshalInternal(outV.Interface())
+		if err != nil {
+			return reflect.Value{}, fmt.Errorf("encodeToReference: %w", err)
+		}
+	} else if !isNil {
+		// Encode the underlying value of an untracked pointer.
+		outV, err := s.encodeReferenced(encodeElem)
+		if err != nil {
+			return reflect.Value{}, fmt.Errorf("encodeToReference: %w", err)
+		}
 
 		value, err = s.jsonMarshalInternal(outV.Interface())
 		if err != nil {
-			return reflect.Value{}, fmt.Errorf("encodeToPointerValue: %w", err)
+			return reflect.Value{}, fmt.Errorf("encodeToReference: %w", err)
 		}
 	}
 
-	s.pointerIndex++
+	// Pointers that are only referenced once don't need an ID. These aren't
+	// cached, since they won't be referenced again.
+	if s.canInline(key, isNil, isTracked, value) {
+		return reflect.ValueOf(pointerValue{Value: value, inline: true}), nil
+	}
+
+	// Use the pointer ID reserved by an earlier reference, if any.
+	var id pointerID
+	if isTracked {
+		id = s.reservePointerID(key)
+	} else {
+		id = s.nextPointerID()
+	}
+
 	pv := reflect.ValueOf(pointerValue{
-		Pointer: s.pointerIndex,
+		Pointer: id,
 		Value:   value,
 	})
 
-	if !isNil {
+	if isTracked {
 		// Cache the encoded value for the pointer.
-		s.pointerValues[inPtr] = pv
+		s.pointerValues[key] = pv
 	}
 
 	return pv, nil
 }
 
+// Encodes the value of a reference using encodeElem, tracking the depth of
+// nested references.
+func (s *JSONEncoder) encodeReferenced(encodeElem func() (reflect.Value, error)) (reflect.Value, error) {
+	s.referenceDepth++
+	defer func() { s.referenceDepth-- }()
+
+	return encodeElem()
+}
+
+// Returns true if the pointer can be encoded as its underlying value, without
+// a pointerValue object; see WithInlinePointers.
+func (s *JSONEncoder) canInline(key pointerKey, isNil, isTracked bool, value json.RawMessage) bool {
+	if !s.config.inlinePointers || s.dryRun {
+		return false
+	}
+
+	// Non-nil pointers to values that encode as null, e.g, nil pointers, would
+	// be decoded as nil pointers.
+	if !isNil && isNullJSON(value) {
+		return false
+	}
+
+	if isTracked {
+		// The pointer may be shared, or may have been referenced already, e.g,
+		// by a back-reference.
+		if _, referenced := s.pointerIDs[key]; referenced || s.pointerRegions.isShared(key) {
+			return false
+		}
+	}
+
+	// The value can't be inlined if it would be mistaken for a pointerValue, or
+	// for a reference to a well-known instance.
+	return !isPointerValueJSON(value) && !isWellKnownJSON(value)
+}
+
+// Returns true if the JSON is null.
+func isNullJSON(b []byte) bool {
+	return bytes.Equal(bytes.TrimSpace(b), []byte("null"))
+}
+
+// Returns the ID for the pointer, reserving a new reference number if the
+// pointer does not have one yet.
+//
+// Pointers are numbered when they are first referenced, which is usually
+// after their underlying values are encoded. Back-references and references
+// into other values may need a number earlier.
+func (s *JSONEncoder) reservePointerID(key pointerKey) pointerID {
+	if id, ok := s.pointerIDs[key]; ok {
+		return id
+	}
+
+	id := s.nextPointerID()
+	s.pointerIDs[key] = id
+	return id
+}
+
+// Returns the ID for the next reference number, which is provisional if the
+// pointer IDs are rewritten after encoding; see pointerIDRewriter.
+func (s *JSONEncoder) nextPointerID() pointerID {
+	s.pointerIndex++
+	if s.pointerIDRewriter != nil {
+		return s.pointerIDRewriter.provisionalID(s.pointerIndex)
+	}
+	return newPointerID(s.pointerIndex)
+}
+
 // Decodes the pointerValue object and writes it to outPtrV.
 //
 // If the pointerValue is null, nothing is written to outPtrV.
@@ -120,35 +338,96 @@ func (s *JSONDecoder) decodeFromPointerValue(
 		)
 	}
 
-	// Short-circuit null, since outPtrV should already be a null pointer.
+	elemT := outPtrV.Type().Elem()
+	encodedT, err := encodedTypeFor(s.options, elemT)
+	if err != nil {
+		return fmt.Errorf("convertFromPointerValue: %w", err)
+	}
+
+	err = s.decodeFromReference(pv, outPtrV, func(value json.RawMessage) (reflect.Value, func() error, error) {
+		// Unmarshal the underlying JSON value into the encoded type.
+		encodedPtrV := reflect.New(encodedT)
+		if err := json.Unmarshal(value, encodedPtrV.Interface()); err != nil {
+			return zeroValue, nil, err
+		}
+
+		newPtrV := reflect.New(elemT)
+		decode := func() error {
+			return s.decodeTo(encodedPtrV.Elem(), newPtrV.Elem())
+		}
+
+		return newPtrV, decode, nil
+	})
+	if err != nil {
+		return fmt.Errorf("convertFromPointerValue: %w", err)
+	}
+
+	return nil
+}
+
+// Decodes a reference to a value, e.g, a pointer, and writes it to outV.
+//
+// The alloc function unmarshals the JSON of the underlying value, and returns
+// a new reference along with a function that decodes the value into it. The
+// reference is stored before the value is decoded, so that back-references in
+// cyclic data can reuse it.
+func (s *JSONDecoder) decodeFromReference(
+	pv pointerValue,
+	outV reflect.Value,
+	alloc func(value json.RawMessage) (reflect.Value, func() error, error),
+) error {
+	// Short-circuit null, since outV should already be a null reference.
 	if bytes.Equal(pv.Value, []byte("null")) {
 		return nil
 	}
 
+	if pv.wellKnown != "" {
+		instanceV, err := s.resolveWellKnown(pv.wellKnown)
+		if err != nil {
+			return err
+		}
+
+		return setPointer(outV, instanceV, pv.Pointer, "")
+	}
+
+	// Inlined pointers are not shared, so we just decode the value.
+	if pv.inline {
+		newV, decode, err := alloc(pv.Value)
+		if err != nil {
+			return err
+		}
+
+		if err := setPointer(outV, newV, pv.Pointer, ""); err != nil {
+			return err
+		}
+
+		return decode()
+	}
+
 	// If we've already decoded the pointerValue before, reuse the existing value.
 	if val, ok := s.pointerValues[pv.Pointer]; ok {
-		outPtrV.Set(val)
+		return setPointer(outV, val, pv.Pointer, pv.Path)
+	}
+
+	// References without a value may appear before the pointer value itself,
+	// e.g, when using WithPointerReferences, so we set these later.
+	if len(pv.Value) == 0 {
+		s.addFixup(pv.Pointer, pv.Path, outV)
 		return nil
 	}
 
-	// Unmarshal the underlying JSON value into the encoded type.
-	encodedT, err := encodedTypeFor(outPtrV.Type().Elem())
+	newV, decode, err := alloc(pv.Value)
 	if err != nil {
-		return fmt.Errorf("convertFromPointerValue: %w", err)
+		return err
 	}
 
-	encodedPtrV := reflect.New(encodedT)
-	if err := json.Unmarshal(pv.Value, encodedPtrV.Interface()); err != nil {
-		return fmt.Errorf("convertFromPointerValue: %w", err)
+	if err := setPointer(outV, newV, pv.Pointer, ""); err != nil {
+		return err
 	}
 
-	// Instantiate the pointer, then decodeTo the value.
-	setField(outPtrV, reflect.New(outPtrV.Type().Elem()))
-	if err := s.decodeTo(encodedPtrV.Elem(), outPtrV.Elem()); err != nil {
-		return fmt.Errorf("convertFromPointerValue: %w", err)
+	if err := s.storePointer(pv.Pointer, newV); err != nil {
+		return err
 	}
 
-	// Store the decoded value for the pointer so we can reuse it later.
-	s.pointerValues[pv.Pointer] = outPtrV
-	return nil
+	return decode()
 }
@@ -0,0 +1,218 @@
+package unsafely
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// The types used to represent strings and bytes in readable output; see
+// WithReadableOutput.
+var (
+	readableStringType = reflect.TypeFor[readableString]()
+	readableBytesType  = reflect.TypeFor[readableBytes]()
+)
+
+// Represents a string in readable output. Strings with multiple lines are
+// marshaled as arrays of lines, and other strings like encodedString.
+type readableString string
+
+// MarshalJSON implements json.Marshaler.
+func (s readableString) MarshalJSON() ([]byte, error) {
+	if strings.Contains(string(s), "\n") && utf8.ValidString(string(s)) {
+		return json.Marshal(strings.Split(string(s), "\n"))
+	}
+
+	return encodedString(s).MarshalJSON()
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (s *readableString) UnmarshalJSON(b []byte) error {
+	if b = bytes.TrimSpace(b); len(b) == 0 || b[0] != '[' {
+		return (*encodedString)(s).UnmarshalJSON(b)
+	}
+
+	var lines []string
+	if err := json.Unmarshal(b, &lines); err != nil {
+		return err
+	}
+
+	*s = readableString(strings.Join(lines, "\n"))
+	return nil
+}
+
+// Represents a byte slice or array in readable output. Bytes that are
+// printable text are marshaled as {"text":...}, and other bytes, e.g, binary
+// data that happens to be valid UTF-8, as {"hex":"..."}.
+//
+// These are unmarshaled from any of these forms, or the base64 strings and
+// arrays of numbers used by encoding/json.
+type readableBytes []byte
+
+// The JSON representation of readableBytes. Exactly one field is set.
+type readableBytesValue struct {
+	Text *readableString `json:"text,omitempty"`
+	Hex  *string         `json:"hex,omitempty"`
+}
+
+// MarshalJSON implements json.Marshaler.
+func (b readableBytes) MarshalJSON() ([]byte, error) {
+	if b == nil {
+		return []byte("null"), nil
+	}
+
+	if isPrintableText(b) {
+		text := readableString(b)
+		return json.Marshal(readableBytesValue{Text: &text})
+	}
+
+	encoded := hex.EncodeToString(b)
+	return json.Marshal(readableBytesValue{Hex: &encoded})
+}
+
+// Returns true if the bytes are valid UTF-8 and contain only printable
+// characters, newlines and tabs.
+func isPrintableText(b []byte) bool {
+	for len(b) > 0 {
+		r, size := utf8.DecodeRune(b)
+		if r == utf8.RuneError && size <= 1 {
+			return false
+		}
+
+		if !unicode.IsPrint(r) && r != '\n' && r != '\t' {
+			return false
+		}
+
+		b = b[size:]
+	}
+
+	return true
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (b *readableBytes) UnmarshalJSON(data []byte) error {
+	if data = bytes.TrimSpace(data); len(data) == 0 || data[0] != '{' {
+		return json.Unmarshal(data, (*[]byte)(b))
+	}
+
+	var value readableBytesValue
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+
+	switch {
+	case value.Text != nil:
+		*b = readableBytes(*value.Text)
+	case value.Hex != nil:
+		decoded, err := hex.DecodeString(*value.Hex)
+		if err != nil {
+			return fmt.Errorf("readableBytes.UnmarshalJSON(): %w", err)
+		}
+		*b = decoded
+	default:
+		return fmt.Errorf("readableBytes.UnmarshalJSON(): expected text or hex; received %s", data)
+	}
+
+	return nil
+}
+
+// Returns true if values of the type are encoded as readableBytes with the
+// options, i.e, byte slices and arrays.
+func isReadableBytes(options encodingOptions, t reflect.Type) bool {
+	if !options.Readable || (t.Kind() != reflect.Slice && t.Kind() != reflect.Array) {
+		return false
+	}
+
+	return t.Elem() == reflect.TypeFor[byte]()
+}
+
+// Returns true if the provided type is readableBytes.
+func isReadableBytesType(t reflect.Type) bool {
+	return t == readableBytesType
+}
+
+// Encodes the byte slice or array to readableBytes.
+func encodeToReadableBytes(inputV reflect.Value) reflect.Value {
+	if inputV.Kind() == reflect.Slice && inputV.IsNil() {
+		return reflect.ValueOf(readableBytes(nil))
+	}
+
+	// Arrays must be addressable to get their bytes.
+	return reflect.ValueOf(readableBytes(slices.Clone(ensureAddressable(inputV).Bytes())))
+}
+
+// Decodes the readableBytes and writes the byte slice or array to outV.
+func decodeFromReadableBytes(encodedV, outV reflect.Value) error {
+	encoded, ok := encodedV.Interface().(readableBytes)
+	if !ok {
+		return fmt.Errorf(
+			"decodeFromReadableBytes(): expected encodedV to be readableBytes; received %T",
+			encodedV.Interface(),
+		)
+	}
+
+	var decodedV reflect.Value
+	switch outV.Kind() {
+	case reflect.Slice:
+		if encoded == nil {
+			return nil // The slice in outV is nil by default.
+		}
+		decodedV = reflect.MakeSlice(outV.Type(), len(encoded), len(encoded))
+
+	case reflect.Array:
+		if len(encoded) != outV.Len() {
+			return fmt.Errorf("decodeFromReadableBytes(): expected %d bytes for %v; received %d",
+				outV.Len(), outV.Type(), len(encoded))
+		}
+		decodedV = reflect.New(outV.Type()).Elem()
+
+	default:
+		return fmt.Errorf("decodeFromReadableBytes(): unsupported kind for outV: %v", outV.Kind())
+	}
+
+	reflect.Copy(decodedV, reflect.ValueOf([]byte(encoded)))
+	setField(outV, decodedV)
+	return nil
+}
+
+// Reverses the escaping of <, > and & in JSON strings by encoding/json, which
+// escapes these for embedding in HTML.
+func unescapeHTML(b []byte) []byte {
+	out := make([]byte, 0, len(b))
+	for i := 0; i < len(b); i++ {
+		if b[i] != '\\' || i+1 >= len(b) {
+			out = append(out, b[i])
+			continue
+		}
+
+		if b[i+1] == 'u' && i+6 <= len(b) {
+			switch string(b[i+2 : i+6]) {
+			case "003c":
+				out = append(out, '<')
+				i += 5
+				continue
+			case "003e":
+				out = append(out, '>')
+				i += 5
+				continue
+			case "0026":
+				out = append(out, '&')
+				i += 5
+				continue
+			}
+		}
+
+		// Copy other escapes as-is, so an escaped backslash isn't mistaken for
+		// the start of another escape.
+		out = append(out, b[i], b[i+1])
+		i++
+	}
+
+	return out
+}
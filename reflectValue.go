@@ -0,0 +1,212 @@
+package unsafely
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+func init() {
+	registerLeafCodec(encodeToTypeValue, decodeFromTypeValue)
+	registerCodec(encodeToReflectValue, decodeFromReflectValue)
+
+	// Types stored in interfaces have the underlying type *reflect.rtype.
+	rtypeT := reflect.TypeOf(reflect.TypeFor[int]())
+	typeCodec := builtinCodecs[reflect.TypeFor[reflect.Type]()]
+	builtinCodecs[rtypeT] = codec{
+		encodedT: typeCodec.encodedT,
+		encode: func(s *JSONEncoder, inV reflect.Value) (reflect.Value, error) {
+			t := getField(inV).Interface().(reflect.Type)
+			return typeCodec.encode(s, reflect.ValueOf(&t).Elem())
+		},
+		decode: func(s *JSONDecoder, encodedV, outV reflect.Value) error {
+			var t reflect.Type
+			if err := typeCodec.decode(s, encodedV, reflect.ValueOf(&t).Elem()); err != nil {
+				return err
+			}
+
+			if t != nil {
+				setField(outV, reflect.ValueOf(t))
+			}
+			return nil
+		},
+	}
+}
+
+// A reference to a type, which is resolved using the typeutil.Resolver when
+// decoding.
+type typeValue struct {
+	// PtrDepth is the number of pointer indirections to the type.
+	PtrDepth int `json:"ptrDepth,omitempty"`
+
+	// PkgPath is the package path of the type; empty for built-in types.
+	PkgPath string `json:"pkgPath,omitempty"`
+
+	// TypeName is the name of the type, namespaced by PkgPath.
+	TypeName string `json:"typeName,omitempty"`
+
+	// TypeString is the string representation of the type, only included if the
+	// PkgPath and TypeName are empty.
+	TypeString string `json:"typeString,omitempty"`
+}
+
+// Returns a reference to the type.
+func newTypeValue(t reflect.Type) typeValue {
+	// Pointers seem to have no package path or name, and the string
+	// representation isn't canonical.
+	//
+	// To capture a concrete type, we extract the underlying type of the pointer
+	// and record that and the pointer depth separately.
+	var pointerDepth int
+	for t.Kind() == reflect.Pointer {
+		pointerDepth++
+		t = t.Elem()
+	}
+
+	var (
+		pkgPath    = t.PkgPath()
+		typeName   = t.Name()
+		typeString string
+	)
+
+	if pkgPath == "" && typeName == "" {
+		typeString = t.String()
+	}
+
+	return typeValue{
+		PtrDepth:   pointerDepth,
+		PkgPath:    pkgPath,
+		TypeName:   typeName,
+		TypeString: typeString,
+	}
+}
+
+// Returns the string representation of the referenced type, e.g,
+// "*io/fs.PathError".
+func (tv typeValue) String() string {
+	name := tv.TypeString
+	if tv.TypeName != "" {
+		name = tv.TypeName
+		if tv.PkgPath != "" {
+			name = tv.PkgPath + "." + tv.TypeName
+		}
+	}
+
+	return strings.Repeat("*", tv.PtrDepth) + name
+}
+
+// Resolves the referenced type using the configured typeutil.Resolver.
+func (s *JSONDecoder) resolveTypeValue(tv typeValue) (reflect.Type, error) {
+	if s.config.typeResolver == nil {
+		return nil, errors.New(
+			"resolveTypeValue(): a type resolver must be configured using WithTypeResolver() " +
+				"to resolve the types of interface values and reflect types")
+	}
+
+	t, err := s.config.typeResolver.ResolveType(tv.PkgPath, tv.TypeName, tv.TypeString)
+	if err != nil {
+		return nil, fmt.Errorf("resolveTypeValue(): %w", err)
+	}
+
+	// Add the pointer indirections recorded in the pointer depth.
+	for range tv.PtrDepth {
+		t = reflect.PointerTo(t)
+	}
+
+	return t, nil
+}
+
+// Encodes the reflect.Type as a reference to the type; nil if the type is nil.
+func encodeToTypeValue(_ *JSONEncoder, in *reflect.Type) (*typeValue, error) {
+	if *in == nil {
+		return nil, nil
+	}
+
+	tv := newTypeValue(*in)
+	return &tv, nil
+}
+
+func decodeFromTypeValue(s *JSONDecoder, tv *typeValue, out *reflect.Type) error {
+	if tv == nil {
+		return nil
+	}
+
+	t, err := s.resolveTypeValue(*tv)
+	if err != nil {
+		return fmt.Errorf("decodeFromTypeValue: %w", err)
+	}
+
+	*out = t
+	return nil
+}
+
+// Represents a reflect.Value. If the reflectValue is nil, the reflect.Value was
+// the zero Value.
+type reflectValue struct {
+	Type typeValue `json:"type"`
+
+	// Value is a JSON string representing the underlying value.
+	Value json.RawMessage `json:"value"`
+}
+
+// Encodes the type and the underlying value of the reflect.Value. The
+// underlying value is copied, so the decoded reflect.Value does not refer to the
+// same memory, unless it is a pointer.
+func encodeToReflectValue(s *JSONEncoder, in *reflect.Value) (*reflectValue, error) {
+	v := *in
+	if !v.IsValid() {
+		return nil, nil
+	}
+
+	// Values obtained from unexported fields can't be copied, unless we can
+	// access them through their address.
+	if !v.CanAddr() {
+		if !v.CanInterface() {
+			return nil, fmt.Errorf("encodeToReflectValue: can't copy read-only %v value", v.Type())
+		}
+		v = ensureAddressable(v)
+	}
+
+	encodedV, err := s.encode(getField(v))
+	if err != nil {
+		return nil, fmt.Errorf("encodeToReflectValue: %w", err)
+	}
+
+	encodedBytes, err := s.jsonMarshalInternal(encodedV.Interface())
+	if err != nil {
+		return nil, fmt.Errorf("encodeToReflectValue: %w", err)
+	}
+
+	return &reflectValue{Type: newTypeValue(v.Type()), Value: encodedBytes}, nil
+}
+
+func decodeFromReflectValue(s *JSONDecoder, rv *reflectValue, out *reflect.Value) error {
+	if rv == nil {
+		return nil
+	}
+
+	t, err := s.resolveTypeValue(rv.Type)
+	if err != nil {
+		return fmt.Errorf("decodeFromReflectValue: %w", err)
+	}
+
+	encodedT, err := encodedTypeFor(s.options, t)
+	if err != nil {
+		return fmt.Errorf("decodeFromReflectValue: %w", err)
+	}
+
+	encodedPtrV := reflect.New(encodedT)
+	if err := json.Unmarshal(rv.Value, encodedPtrV.Interface()); err != nil {
+		return fmt.Errorf("decodeFromReflectValue: %w", err)
+	}
+
+	decodedV := reflect.New(t).Elem()
+	if err := s.decodeTo(encodedPtrV.Elem(), decodedV); err != nil {
+		return fmt.Errorf("decodeFromReflectValue: %w", err)
+	}
+
+	*out = decodedV
+	return nil
+}
@@ -0,0 +1,149 @@
+package unsafely
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+)
+
+// The type used to represent slices in encoded structs when using
+// WithSliceAliasing.
+var sliceValueType = reflect.TypeFor[*sliceValue]()
+
+// Returns true if the provided type is a *sliceValue.
+func isSliceValueType(t reflect.Type) bool {
+	return t == sliceValueType
+}
+
+// Represents a slice stored in a field, including its backing array. If the
+// sliceValue is nil, the slice was nil.
+type sliceValue struct {
+	// Len is the length of the slice.
+	Len int `json:"len"`
+
+	// Cap is the capacity of the slice.
+	Cap int `json:"cap"`
+
+	// Array is a pointer to the backing array, starting at the first element of
+	// the slice and with the capacity of the slice as its length.
+	//
+	// Slices that share a backing array are encoded as pointers into the
+	// largest backing array that was encoded.
+	Array pointerValue `json:"array"`
+}
+
+// Encodes the slice to a sliceValue object.
+//
+// If the slice is nil, returns a nil *sliceValue.
+func (s *JSONEncoder) encodeToSliceValue(inV reflect.Value) (reflect.Value, error) {
+	if inV.Kind() != reflect.Slice {
+		return zeroValue, fmt.Errorf(
+			"encodeToSliceValue: expected value to be a slice; received %v", inV.Kind(),
+		)
+	}
+
+	if inV.IsNil() {
+		return reflect.ValueOf((*sliceValue)(nil)), nil
+	}
+
+	// Treat the slice as a pointer to an array with the capacity of the slice.
+	var (
+		arrayT   = reflect.ArrayOf(inV.Cap(), inV.Type().Elem())
+		arrayPtr = reflect.NewAt(arrayT, inV.UnsafePointer())
+	)
+
+	pv, err := s.encodeToPointerValue(arrayPtr)
+	if err != nil {
+		return zeroValue, fmt.Errorf("encodeToSliceValue: %w", err)
+	}
+
+	return reflect.ValueOf(&sliceValue{
+		Len:   inV.Len(),
+		Cap:   inV.Cap(),
+		Array: pv.Interface().(pointerValue),
+	}), nil
+}
+
+// Decodes the sliceValue object and writes the slice to outV.
+func (s *JSONDecoder) decodeFromSliceValue(encodedV, outV reflect.Value) error {
+	sv, ok := encodedV.Interface().(*sliceValue)
+	if !ok {
+		return fmt.Errorf(
+			"decodeFromSliceValue: expected encodedV to be a *sliceValue; received %T",
+			encodedV.Interface(),
+		)
+	}
+
+	if outV.Kind() != reflect.Slice {
+		return fmt.Errorf("decodeFromSliceValue: expected outV to be a slice; received %v", outV.Kind())
+	}
+
+	// Nil slice; outV should already be nil.
+	if sv == nil {
+		return nil
+	}
+
+	if sv.Len < 0 || sv.Len > sv.Cap {
+		return fmt.Errorf("decodeFromSliceValue: invalid length %d for capacity %d", sv.Len, sv.Cap)
+	}
+
+	if err := checkSliceCap(sv, outV.Type().Elem()); err != nil {
+		return fmt.Errorf("decodeFromSliceValue: %w", err)
+	}
+
+	// Decode the pointer to the backing array, then slice it. If the backing
+	// array has not been decoded yet, the slice is set once it is.
+	var (
+		arrayT     = reflect.ArrayOf(sv.Cap, outV.Type().Elem())
+		arrayPtrV  = reflect.New(reflect.PointerTo(arrayT)).Elem()
+		setSliceFn = func() {
+			if arrayPtrV.IsNil() {
+				return
+			}
+
+			slice := arrayPtrV.Elem().Slice3(0, sv.Len, sv.Cap)
+			setField(outV, slice.Convert(outV.Type()))
+		}
+	)
+
+	err := s.watchFixups(
+		func() error {
+			return s.decodeFromPointerValue(reflect.ValueOf(sv.Array), arrayPtrV)
+		},
+		setSliceFn,
+	)
+	if err != nil {
+		return fmt.Errorf("decodeFromSliceValue: %w", err)
+	}
+
+	setSliceFn()
+	return nil
+}
+
+// Returns an error if the capacity of the sliceValue does not fit in memory, or
+// exceeds the length of the encoded backing array.
+//
+// The capacity is checked before creating the array type, so that a corrupt
+// capacity cannot cause a huge allocation. Backing arrays that are stored
+// elsewhere are checked when the reference is resolved; see pointerAtPath.
+func checkSliceCap(sv *sliceValue, elemT reflect.Type) error {
+	if size := elemT.Size(); size > 0 && uintptr(sv.Cap) > math.MaxInt/size {
+		return fmt.Errorf("capacity %d is too large for %v", sv.Cap, elemT)
+	}
+
+	if len(sv.Array.Value) == 0 || isNullJSON(sv.Array.Value) {
+		return nil
+	}
+
+	var elems []json.RawMessage
+	if err := json.Unmarshal(sv.Array.Value, &elems); err != nil {
+		return fmt.Errorf("invalid backing array: %w", err)
+	}
+
+	if sv.Cap > len(elems) {
+		return fmt.Errorf("capacity %d exceeds the length %d of the backing array", sv.Cap, len(elems))
+	}
+
+	return nil
+}
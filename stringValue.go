@@ -0,0 +1,128 @@
+package unsafely
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// The type used to represent strings in encoded values.
+var encodedStringType = reflect.TypeFor[encodedString]()
+
+// Represents a string. Strings that are valid UTF-8 are marshaled as JSON
+// strings. Otherwise, encoding/json would replace the invalid bytes, so these
+// are marshaled as {"escaped":"..."}, with the invalid bytes escaped; see
+// escapeInvalidUTF8.
+type encodedString string
+
+// A string containing invalid UTF-8.
+type escapedString struct {
+	Escaped string `json:"escaped"`
+}
+
+// MarshalJSON implements json.Marshaler.
+func (s encodedString) MarshalJSON() ([]byte, error) {
+	if utf8.ValidString(string(s)) {
+		return json.Marshal(string(s))
+	}
+
+	return json.Marshal(escapedString{Escaped: escapeInvalidUTF8(string(s))})
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (s *encodedString) UnmarshalJSON(b []byte) error {
+	if b = bytes.TrimSpace(b); len(b) == 0 || b[0] != '{' {
+		return json.Unmarshal(b, (*string)(s))
+	}
+
+	var es escapedString
+	if err := json.Unmarshal(b, &es); err != nil {
+		return err
+	}
+
+	unescaped, err := unescapeInvalidUTF8(es.Escaped)
+	if err != nil {
+		return err
+	}
+
+	*s = encodedString(unescaped)
+	return nil
+}
+
+// Escapes the bytes that are not valid UTF-8 in the string as \xNN, and
+// backslashes as \\, e.g, "caf\xe9" is escaped as `caf\xe9`.
+func escapeInvalidUTF8(s string) string {
+	var b strings.Builder
+	for len(s) > 0 {
+		r, size := utf8.DecodeRuneInString(s)
+		switch {
+		case r == utf8.RuneError && size == 1:
+			fmt.Fprintf(&b, `\x%02x`, s[0])
+		case r == '\\':
+			b.WriteString(`\\`)
+		default:
+			b.WriteString(s[:size])
+		}
+		s = s[size:]
+	}
+
+	return b.String()
+}
+
+// Reverses escapeInvalidUTF8.
+func unescapeInvalidUTF8(s string) (string, error) {
+	var b strings.Builder
+	for {
+		i := strings.IndexByte(s, '\\')
+		if i < 0 {
+			b.WriteString(s)
+			return b.String(), nil
+		}
+
+		b.WriteString(s[:i])
+		s = s[i:]
+
+		switch {
+		case strings.HasPrefix(s, `\\`):
+			b.WriteByte('\\')
+			s = s[2:]
+		case strings.HasPrefix(s, `\x`) && len(s) >= 4:
+			c, err := strconv.ParseUint(s[2:4], 16, 8)
+			if err != nil {
+				return "", fmt.Errorf("unescapeInvalidUTF8(): invalid escape %q", s[:4])
+			}
+			b.WriteByte(byte(c))
+			s = s[4:]
+		default:
+			return "", fmt.Errorf("unescapeInvalidUTF8(): invalid escape in %q", s)
+		}
+	}
+}
+
+// Map keys that contain invalid UTF-8 are escaped, and prefixed with a null
+// character. Keys that start with a null character are also escaped, so they
+// aren't mistaken for escaped keys.
+const escapedMapKeyPrefix = "\x00"
+
+// Returns the JSON key for the string map key.
+func escapeMapKey(key string) string {
+	if utf8.ValidString(key) && !strings.HasPrefix(key, escapedMapKeyPrefix) {
+		return key
+	}
+
+	return escapedMapKeyPrefix + escapeInvalidUTF8(key)
+}
+
+// Reverses escapeMapKey.
+func unescapeMapKey(key string) (string, error) {
+	escaped, ok := strings.CutPrefix(key, escapedMapKeyPrefix)
+	if !ok {
+		return key, nil
+	}
+
+	return unescapeInvalidUTF8(escaped)
+}
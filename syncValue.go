@@ -0,0 +1,405 @@
+package unsafely
+
+import (
+	"fmt"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+)
+
+func init() {
+	registerLeafCodec(encodeToMutexValue, decodeFromMutexValue)
+	registerLeafCodec(encodeToRWMutexValue, decodeFromRWMutexValue)
+	registerLeafCodec(encodeToWaitGroupValue, decodeFromWaitGroupValue)
+	registerLeafCodec(encodeToOnceValue, decodeFromOnceValue)
+	registerCodec(encodeToSyncMapValue, decodeFromSyncMapValue)
+	registerCodec(encodeToAtomicValue, decodeFromAtomicValue)
+	atomicTypes = append(atomicTypes, reflect.TypeFor[atomic.Value]())
+
+	registerAtomicCodec[atomic.Bool, bool]()
+	registerAtomicCodec[atomic.Int32, int32]()
+	registerAtomicCodec[atomic.Int64, int64]()
+	registerAtomicCodec[atomic.Uint32, uint32]()
+	registerAtomicCodec[atomic.Uint64, uint64]()
+	registerAtomicCodec[atomic.Uintptr, uintptr]()
+
+	// Pools only contain cached values, so they are not encoded.
+	builtinCodecs[reflect.TypeFor[sync.Pool]()] = codec{
+		encodedT: reflect.TypeFor[struct{}](),
+		encode: func(*JSONEncoder, reflect.Value) (reflect.Value, error) {
+			return reflect.ValueOf(struct{}{}), nil
+		},
+		decode: func(*JSONDecoder, reflect.Value, reflect.Value) error { return nil },
+		skip:   true,
+		leaf:   true,
+	}
+
+	genericCodecs = append(genericCodecs, atomicPointerCodec, definedAtomicCodec)
+}
+
+// The sync/atomic types with built-in codecs, other than atomic.Pointer[T].
+var atomicTypes []reflect.Type
+
+// Represents the state of a sync.Mutex.
+type mutexValue struct {
+	Locked bool `json:"locked"`
+}
+
+// Represents the state of a sync.RWMutex.
+type rwMutexValue struct {
+	// Locked is true if a writer holds the lock, or is waiting for it.
+	Locked bool `json:"locked"`
+
+	// Readers is the number of readers holding the lock.
+	Readers int32 `json:"readers"`
+}
+
+// Represents the state of a sync.WaitGroup.
+type waitGroupValue struct {
+	Count int32 `json:"count"`
+}
+
+// Represents the state of a sync.Once.
+type onceValue struct {
+	Done bool `json:"done"`
+}
+
+// The following mirror the fields of the sync types, which must be kept in
+// sync with the sync package.
+
+type mutexLayout struct {
+	state int32
+	sema  uint32
+}
+
+type rwMutexLayout struct {
+	w           mutexLayout
+	writerSem   uint32
+	readerSem   uint32
+	readerCount atomic.Int32
+	readerWait  atomic.Int32
+}
+
+type waitGroupLayout struct {
+	state atomic.Uint64
+	sema  uint32
+}
+
+// Fail to compile if the layouts have different sizes than the sync types.
+var (
+	_ [unsafe.Sizeof(sync.Mutex{}) - unsafe.Sizeof(mutexLayout{})]struct{}
+	_ [unsafe.Sizeof(mutexLayout{}) - unsafe.Sizeof(sync.Mutex{})]struct{}
+	_ [unsafe.Sizeof(sync.RWMutex{}) - unsafe.Sizeof(rwMutexLayout{})]struct{}
+	_ [unsafe.Sizeof(rwMutexLayout{}) - unsafe.Sizeof(sync.RWMutex{})]struct{}
+	_ [unsafe.Sizeof(sync.WaitGroup{}) - unsafe.Sizeof(waitGroupLayout{})]struct{}
+	_ [unsafe.Sizeof(waitGroupLayout{}) - unsafe.Sizeof(sync.WaitGroup{})]struct{}
+)
+
+const (
+	mutexLocked       = 1
+	rwmutexMaxReaders = 1 << 30
+)
+
+// The result of checking that the layouts match the sync types, which is
+// checked before the first sync value is encoded.
+var syncLayoutErr = sync.OnceValue(checkSyncLayouts)
+
+// Checks the layouts against sync values in known states, so that changes to
+// the sync package fail loudly rather than reading the wrong fields.
+func checkSyncLayouts() error {
+	var (
+		mu   sync.Mutex
+		rw   sync.RWMutex
+		wg   sync.WaitGroup
+		once sync.Once
+	)
+
+	mu.Lock()
+	rw.RLock()
+	rw.RLock()
+	readers := (*rwMutexLayout)(unsafe.Pointer(&rw)).readerCount.Load()
+	rw.RUnlock()
+	rw.RUnlock()
+	rw.Lock()
+	wg.Add(3)
+	once.Do(func() {})
+
+	var (
+		muState  = atomic.LoadInt32(&(*mutexLayout)(unsafe.Pointer(&mu)).state)
+		rwLocked = (*rwMutexLayout)(unsafe.Pointer(&rw)).readerCount.Load()
+		wgState  = (*waitGroupLayout)(unsafe.Pointer(&wg)).state.Load()
+		onceDone = (*atomic.Bool)(unsafe.Pointer(&once)).Load()
+	)
+
+	mu.Unlock()
+	rw.Unlock()
+	wg.Add(-3)
+
+	if muState&mutexLocked == 0 || readers != 2 || rwLocked != -rwmutexMaxReaders ||
+		wgState>>32 != 3 || !onceDone {
+		return fmt.Errorf("unsupported sync layouts in %s; the layouts must be updated", runtime.Version())
+	}
+
+	return nil
+}
+
+func encodeToMutexValue(s *JSONEncoder, in *sync.Mutex) (mutexValue, error) {
+	if err := syncLayoutErr(); err != nil {
+		return mutexValue{}, fmt.Errorf("encodeToMutexValue: %w", err)
+	}
+
+	// The mutex was unlocked before the encoder locked it.
+	if s.holdsLock(unsafe.Pointer(in)) {
+		return mutexValue{}, nil
+	}
+
+	state := atomic.LoadInt32(&(*mutexLayout)(unsafe.Pointer(in)).state)
+	return mutexValue{Locked: state&mutexLocked != 0}, nil
+}
+
+func decodeFromMutexValue(s *JSONDecoder, mv mutexValue, out *sync.Mutex) error {
+	if mv.Locked && s.config.lockStates {
+		out.Lock()
+	}
+	return nil
+}
+
+func encodeToRWMutexValue(s *JSONEncoder, in *sync.RWMutex) (rwMutexValue, error) {
+	if err := syncLayoutErr(); err != nil {
+		return rwMutexValue{}, fmt.Errorf("encodeToRWMutexValue: %w", err)
+	}
+
+	readers := (*rwMutexLayout)(unsafe.Pointer(in)).readerCount.Load()
+
+	// The reader count is negative while a writer holds the lock, or is waiting
+	// for readers to release it.
+	locked := readers < 0
+	if locked {
+		readers += rwmutexMaxReaders
+	}
+
+	// Exclude the read lock held by the encoder.
+	if s.holdsLock(unsafe.Pointer(in)) {
+		readers--
+	}
+
+	return rwMutexValue{Locked: locked, Readers: readers}, nil
+}
+
+func decodeFromRWMutexValue(s *JSONDecoder, rv rwMutexValue, out *sync.RWMutex) error {
+	if !s.config.lockStates {
+		return nil
+	}
+
+	if rv.Locked {
+		out.Lock()
+		return nil
+	}
+
+	for range rv.Readers {
+		out.RLock()
+	}
+	return nil
+}
+
+func encodeToWaitGroupValue(_ *JSONEncoder, in *sync.WaitGroup) (waitGroupValue, error) {
+	if err := syncLayoutErr(); err != nil {
+		return waitGroupValue{}, fmt.Errorf("encodeToWaitGroupValue: %w", err)
+	}
+
+	state := (*waitGroupLayout)(unsafe.Pointer(in)).state.Load()
+	return waitGroupValue{Count: int32(state >> 32)}, nil
+}
+
+func decodeFromWaitGroupValue(s *JSONDecoder, wv waitGroupValue, out *sync.WaitGroup) error {
+	if wv.Count < 0 {
+		return fmt.Errorf("decodeFromWaitGroupValue: negative count %d", wv.Count)
+	}
+
+	if wv.Count > 0 && s.config.lockStates {
+		out.Add(int(wv.Count))
+	}
+	return nil
+}
+
+func encodeToOnceValue(_ *JSONEncoder, in *sync.Once) (onceValue, error) {
+	if err := syncLayoutErr(); err != nil {
+		return onceValue{}, fmt.Errorf("encodeToOnceValue: %w", err)
+	}
+
+	// The done flag is the first field after the zero-sized noCopy.
+	done := (*atomic.Bool)(unsafe.Pointer(in)).Load()
+	return onceValue{Done: done}, nil
+}
+
+func decodeFromOnceValue(_ *JSONDecoder, ov onceValue, out *sync.Once) error {
+	if ov.Done {
+		out.Do(func() {})
+	}
+	return nil
+}
+
+// Encodes the contents of the sync.Map like a map[any]any.
+func encodeToSyncMapValue(s *JSONEncoder, in *sync.Map) (map[string]*interfaceValue, error) {
+	contents := make(map[any]any)
+	in.Range(func(key, value any) bool {
+		contents[key] = value
+		return true
+	})
+
+	encodedV, err := s.encode(reflect.ValueOf(&contents).Elem())
+	if err != nil {
+		return nil, fmt.Errorf("encodeToSyncMapValue: %w", err)
+	}
+
+	return encodedV.Interface().(map[string]*interfaceValue), nil
+}
+
+func decodeFromSyncMapValue(s *JSONDecoder, encoded map[string]*interfaceValue, out *sync.Map) error {
+	var contents map[any]any
+	if err := s.decodeTo(reflect.ValueOf(encoded), reflect.ValueOf(&contents).Elem()); err != nil {
+		return fmt.Errorf("decodeFromSyncMapValue: %w", err)
+	}
+
+	for key, value := range contents {
+		out.Store(key, value)
+	}
+	return nil
+}
+
+// Encodes the value loaded from the atomic.Value like an interface.
+func encodeToAtomicValue(s *JSONEncoder, in *atomic.Value) (*interfaceValue, error) {
+	value := in.Load()
+
+	encodedV, err := s.encode(reflect.ValueOf(&value).Elem())
+	if err != nil {
+		return nil, fmt.Errorf("encodeToAtomicValue: %w", err)
+	}
+
+	return encodedV.Interface().(*interfaceValue), nil
+}
+
+func decodeFromAtomicValue(s *JSONDecoder, encoded *interfaceValue, out *atomic.Value) error {
+	var (
+		value  any
+		valueV = reflect.ValueOf(&value).Elem()
+		store  = func() {
+			if value != nil {
+				out.Store(value)
+			}
+		}
+	)
+
+	err := s.watchFixups(func() error { return s.decodeTo(reflect.ValueOf(encoded), valueV) }, store)
+	if err != nil {
+		return fmt.Errorf("decodeFromAtomicValue: %w", err)
+	}
+
+	store()
+	return nil
+}
+
+// The atomic integer and bool types.
+type atomicPrimitive[V any] interface {
+	Load() V
+	Store(V)
+}
+
+// Registers a codec that encodes the atomic type A as the value loaded from
+// it, of type V.
+func registerAtomicCodec[A any, V any, PA interface {
+	*A
+	atomicPrimitive[V]
+}]() {
+	registerLeafCodec(
+		func(_ *JSONEncoder, in *A) (V, error) {
+			return PA(in).Load(), nil
+		},
+		func(_ *JSONDecoder, value V, out *A) error {
+			PA(out).Store(value)
+			return nil
+		},
+	)
+
+	atomicTypes = append(atomicTypes, reflect.TypeFor[A]())
+}
+
+// Returns a codec for types defined as sync/atomic types, e.g,
+// "type counter atomic.Int64", which don't have the methods of the atomic
+// types. Values of these types are encoded as the atomic types, so they are
+// also read and written atomically.
+func definedAtomicCodec(t reflect.Type) (codec, bool) {
+	if t.Kind() != reflect.Struct || t.PkgPath() == "sync/atomic" {
+		return codec{}, false
+	}
+
+	for _, atomicT := range atomicTypes {
+		if !t.ConvertibleTo(atomicT) {
+			continue
+		}
+
+		c := builtinCodecs[atomicT]
+		return codec{
+			encodedT: c.encodedT,
+			encode: func(s *JSONEncoder, inV reflect.Value) (reflect.Value, error) {
+				return c.encode(s, reflect.NewAt(atomicT, ensureAddressable(inV).Addr().UnsafePointer()).Elem())
+			},
+			decode: func(s *JSONDecoder, encodedV, outV reflect.Value) error {
+				return c.decode(s, encodedV, reflect.NewAt(atomicT, outV.Addr().UnsafePointer()).Elem())
+			},
+		}, true
+	}
+
+	return codec{}, false
+}
+
+// Returns a codec for atomic.Pointer[T], which encodes the loaded pointer like
+// a *T.
+func atomicPointerCodec(t reflect.Type) (codec, bool) {
+	if t.PkgPath() != "sync/atomic" || !strings.HasPrefix(t.Name(), "Pointer[") {
+		return codec{}, false
+	}
+
+	// atomic.Pointer[T] has the fields: _ [0]*T, _ noCopy, v unsafe.Pointer
+	ptrField, ok := t.FieldByName("v")
+	if !ok || t.NumField() == 0 || t.Field(0).Type.Kind() != reflect.Array {
+		return codec{}, false
+	}
+
+	var (
+		ptrT   = t.Field(0).Type.Elem()
+		offset = ptrField.Offset
+	)
+
+	return codec{
+		encodedT: pointerValueType,
+		encode: func(s *JSONEncoder, inV reflect.Value) (reflect.Value, error) {
+			addr := (*unsafe.Pointer)(unsafe.Add(ensureAddressable(inV).Addr().UnsafePointer(), offset))
+
+			ptrV := reflect.Zero(ptrT)
+			if ptr := atomic.LoadPointer(addr); ptr != nil {
+				ptrV = reflect.NewAt(ptrT.Elem(), ptr)
+			}
+
+			return s.encodeToPointerValue(ptrV)
+		},
+		decode: func(s *JSONDecoder, encodedV, outV reflect.Value) error {
+			var (
+				addr  = (*unsafe.Pointer)(unsafe.Add(outV.Addr().UnsafePointer(), offset))
+				ptrV  = reflect.New(ptrT).Elem()
+				store = func() { atomic.StorePointer(addr, ptrV.UnsafePointer()) }
+			)
+
+			err := s.watchFixups(func() error { return s.decodeFromPointerValue(encodedV, ptrV) }, store)
+			if err != nil {
+				return err
+			}
+
+			store()
+			return nil
+		},
+	}, true
+}
@@ -0,0 +1,208 @@
+package unsafely
+
+import (
+	"fmt"
+	"time"
+	"unsafe"
+)
+
+func init() {
+	registerLeafCodec(encodeToTimeValue, decodeFromTimeValue)
+	registerLeafCodec(encodeToLocationValue, decodeFromLocationValue)
+}
+
+// Mirrors the fields of time.Time, which must be kept in sync with the time
+// package.
+type timeLayout struct {
+	wall uint64
+	ext  int64
+	loc  *time.Location
+}
+
+// Represents a time.Time, including its monotonic clock reading and location.
+type timeValue struct {
+	// Time is the time in RFC 3339 format. This is only for readability, and is
+	// ignored when decoding.
+	Time string `json:"time"`
+
+	// Wall and Ext are the internal fields of the time.Time.
+	Wall uint64 `json:"wall"`
+	Ext  int64  `json:"ext"`
+
+	// Location is the location of the time; nil for UTC.
+	Location *locationValue `json:"loc,omitempty"`
+}
+
+// Represents a *time.Location by name.
+type locationValue struct {
+	// Name is the name of the location, e.g, "America/New_York", "UTC" or
+	// "Local".
+	Name string `json:"name"`
+
+	// Offset is the offset in seconds east of UTC, if the location could not be
+	// loaded by name, e.g, if it was created by time.FixedZone.
+	Offset *int `json:"offset,omitempty"`
+}
+
+// Encodes the time to a timeValue object.
+func encodeToTimeValue(s *JSONEncoder, in *time.Time) (timeValue, error) {
+	layout := (*timeLayout)(unsafe.Pointer(in))
+
+	tv := timeValue{
+		Time: in.Format(time.RFC3339Nano),
+		Wall: layout.wall,
+		Ext:  layout.ext,
+	}
+
+	// The location of UTC times is nil.
+	if layout.loc != nil {
+		tv.Location = s.encodeLocation(layout.loc, *in)
+	}
+
+	return tv, nil
+}
+
+// Decodes the timeValue object to the time.
+func decodeFromTimeValue(s *JSONDecoder, tv timeValue, out *time.Time) error {
+	layout := (*timeLayout)(unsafe.Pointer(out))
+	layout.wall = tv.Wall
+	layout.ext = tv.Ext
+	layout.loc = nil
+
+	if tv.Location != nil {
+		loc, err := s.decodeLocation(tv.Location)
+		if err != nil {
+			return fmt.Errorf("decodeFromTimeValue: %w", err)
+		}
+
+		// The time package represents UTC using a nil location.
+		if loc != time.UTC {
+			layout.loc = loc
+		}
+	}
+
+	return nil
+}
+
+// Encodes the *time.Location to a locationValue object.
+func encodeToLocationValue(s *JSONEncoder, in **time.Location) (*locationValue, error) {
+	loc := *in
+	if loc == nil {
+		return nil, nil
+	}
+
+	// The location is compared with the loaded location at the current time,
+	// and in the winter and summer of the current year.
+	now := time.Now()
+	return s.encodeLocation(
+		loc,
+		now,
+		time.Date(now.Year(), time.January, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(now.Year(), time.July, 1, 0, 0, 0, 0, time.UTC),
+	), nil
+}
+
+// Decodes the locationValue object to the *time.Location.
+func decodeFromLocationValue(s *JSONDecoder, lv *locationValue, out **time.Location) error {
+	if lv == nil {
+		*out = nil
+		return nil
+	}
+
+	loc, err := s.decodeLocation(lv)
+	if err != nil {
+		return fmt.Errorf("decodeFromLocationValue: %w", err)
+	}
+
+	*out = loc
+	return nil
+}
+
+// Returns the locationValue for the location. The location is encoded by name
+// if the location loaded by name has the same zones at the given instants,
+// e.g, the time being encoded. Otherwise, e.g, for time.FixedZone("EST", 0),
+// the offset at the first instant is included.
+func (s *JSONEncoder) encodeLocation(loc *time.Location, instants ...time.Time) *locationValue {
+	name := loc.String()
+	if loc == time.UTC || loc == time.Local {
+		return &locationValue{Name: name}
+	}
+
+	if loaded := s.loadLocation(name); loaded != nil && sameZones(loc, loaded, instants) {
+		return &locationValue{Name: name}
+	}
+
+	_, offset := instants[0].In(loc).Zone()
+	return &locationValue{Name: name, Offset: &offset}
+}
+
+// Returns the location that time.LoadLocation returns for the name, or nil if
+// it can't be loaded. The empty name, "UTC" and "Local" are excluded, since
+// time.LoadLocation returns time.UTC or time.Local for these, so other
+// locations with these names, e.g, the unnamed locations created by time.Parse
+// for numeric offsets, would lose their offsets.
+func (s *JSONEncoder) loadLocation(name string) *time.Location {
+	switch name {
+	case "", "UTC", "Local":
+		return nil
+	}
+
+	if loc, ok := s.loadedLocations[name]; ok {
+		return loc
+	}
+
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		loc = nil
+	}
+
+	if s.loadedLocations == nil {
+		s.loadedLocations = make(map[string]*time.Location)
+	}
+	s.loadedLocations[name] = loc
+
+	return loc
+}
+
+// Returns true if the locations have the same zone names and offsets at each
+// of the instants.
+func sameZones(a, b *time.Location, instants []time.Time) bool {
+	for _, instant := range instants {
+		nameA, offsetA := instant.In(a).Zone()
+		nameB, offsetB := instant.In(b).Zone()
+		if nameA != nameB || offsetA != offsetB {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Returns the location for the locationValue. Locations loaded by name are
+// reused, so decoded times in the same location share a *time.Location.
+func (s *JSONDecoder) decodeLocation(lv *locationValue) (*time.Location, error) {
+	switch {
+	case lv.Offset != nil:
+		return time.FixedZone(lv.Name, *lv.Offset), nil
+	case lv.Name == "UTC":
+		return time.UTC, nil
+	case lv.Name == "Local":
+		return time.Local, nil
+	}
+
+	if loc, ok := s.locations[lv.Name]; ok {
+		return loc, nil
+	}
+
+	loc, err := time.LoadLocation(lv.Name)
+	if err != nil {
+		return nil, fmt.Errorf("decodeLocation(): %w", err)
+	}
+
+	if s.locations == nil {
+		s.locations = make(map[string]*time.Location)
+	}
+	s.locations[lv.Name] = loc
+
+	return loc, nil
+}
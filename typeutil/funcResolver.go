@@ -0,0 +1,38 @@
+package typeutil
+
+import (
+	"reflect"
+	"regexp"
+	"runtime"
+)
+
+// FuncResolver is an interface for resolving functions by their symbol names.
+type FuncResolver interface {
+	// ResolveFunc resolves the function with the symbol name (see FuncName) and
+	// the function type, or returns an error.
+	ResolveFunc(name string, funcT reflect.Type) (reflect.Value, error)
+}
+
+// Matches the suffixes the compiler adds to the symbol names of closures and
+// method values, e.g, "pkg.outer.func1" or "pkg.T.Method-fm".
+var closureSuffix = regexp.MustCompile(`(\.func\d+(\.\d+)*|-fm)$`)
+
+// FuncName returns the fully qualified symbol name of the function, e.g,
+// "net/http.NotFound" or "example.com/pkg.(*T).Method", and whether the
+// function is a closure or method value, which may capture state that is not
+// part of the function.
+//
+// Returns an empty name if the function is nil or its symbol is unknown.
+func FuncName(fn reflect.Value) (name string, isClosure bool) {
+	if fn.Kind() != reflect.Func || fn.IsNil() {
+		return "", false
+	}
+
+	runtimeFunc := runtime.FuncForPC(fn.Pointer())
+	if runtimeFunc == nil {
+		return "", false
+	}
+
+	name = runtimeFunc.Name()
+	return name, closureSuffix.MatchString(name)
+}
@@ -0,0 +1,57 @@
+package typeutil
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// StaticFuncResolver is a function resolver that uses a static map of
+// functions.
+type StaticFuncResolver struct {
+	// Map from symbol name -> function.
+	funcs map[string]reflect.Value
+}
+
+// NewStaticFuncResolver returns a new StaticFuncResolver.
+func NewStaticFuncResolver() StaticFuncResolver {
+	return StaticFuncResolver{funcs: make(map[string]reflect.Value)}
+}
+
+// AddFuncs adds the functions to the StaticFuncResolver, e.g, top-level
+// functions or method expressions like (*T).Method.
+//
+// Panics if a value is not a non-nil function.
+func (s StaticFuncResolver) AddFuncs(funcs ...any) StaticFuncResolver {
+	for _, fn := range funcs {
+		fnV := reflect.ValueOf(fn)
+
+		name, _ := FuncName(fnV)
+		if name == "" {
+			panic(fmt.Sprintf("StaticFuncResolver.AddFuncs(): expected a non-nil function; received %T", fn))
+		}
+
+		s.funcs[name] = fnV
+	}
+
+	return s
+}
+
+// ResolveFunc (see FuncResolver.ResolveFunc).
+//
+// The function may be converted to funcT, e.g, from func(http.ResponseWriter,
+// *http.Request) to http.HandlerFunc.
+func (s StaticFuncResolver) ResolveFunc(name string, funcT reflect.Type) (reflect.Value, error) {
+	fnV, ok := s.funcs[name]
+	if !ok {
+		return reflect.Value{}, fmt.Errorf("StaticFuncResolver.ResolveFunc(): could not find function %s", name)
+	}
+
+	if !fnV.Type().ConvertibleTo(funcT) {
+		return reflect.Value{}, fmt.Errorf(
+			"StaticFuncResolver.ResolveFunc(): function %s has type %v; expected %v",
+			name, fnV.Type(), funcT,
+		)
+	}
+
+	return fnV.Convert(funcT), nil
+}
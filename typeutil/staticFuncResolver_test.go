@@ -0,0 +1,90 @@
+package typeutil_test
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/outriggerlabs/unsafely/typeutil"
+)
+
+type funcReceiver struct{}
+
+func (funcReceiver) Method() string { return "method" }
+
+func topLevelFunc() string { return "top-level" }
+
+func TestFuncName(t *testing.T) {
+	closure := func() string { return "closure" }
+
+	tests := map[string]struct {
+		fn            any
+		expectedName  string
+		expectClosure bool
+	}{
+		"top-level function": {
+			fn:           topLevelFunc,
+			expectedName: "github.com/outriggerlabs/unsafely/typeutil_test.topLevelFunc",
+		},
+		"method expression": {
+			fn:           funcReceiver.Method,
+			expectedName: "github.com/outriggerlabs/unsafely/typeutil_test.funcReceiver.Method",
+		},
+		"closure": {
+			fn:            closure,
+			expectedName:  "github.com/outriggerlabs/unsafely/typeutil_test.TestFuncName.func1",
+			expectClosure: true,
+		},
+		"method value": {
+			fn:            funcReceiver{}.Method,
+			expectedName:  "github.com/outriggerlabs/unsafely/typeutil_test.funcReceiver.Method-fm",
+			expectClosure: true,
+		},
+		"nil": {
+			fn: (func())(nil),
+		},
+	}
+
+	for desc, test := range tests {
+		t.Run(desc, func(t *testing.T) {
+			name, isClosure := typeutil.FuncName(reflect.ValueOf(test.fn))
+			assert.Equal(t, test.expectedName, name)
+			assert.Equal(t, test.expectClosure, isClosure)
+		})
+	}
+}
+
+func TestStaticFuncResolver(t *testing.T) {
+	resolver := typeutil.NewStaticFuncResolver().AddFuncs(topLevelFunc, http.NotFound)
+
+	t.Run("resolve function", func(t *testing.T) {
+		fn, err := resolver.ResolveFunc(
+			"github.com/outriggerlabs/unsafely/typeutil_test.topLevelFunc", reflect.TypeFor[func() string](),
+		)
+		require.NoError(t, err)
+		assert.Equal(t, "top-level", fn.Interface().(func() string)())
+	})
+
+	t.Run("resolve named function type", func(t *testing.T) {
+		fn, err := resolver.ResolveFunc("net/http.NotFound", reflect.TypeFor[http.HandlerFunc]())
+		require.NoError(t, err)
+		assert.IsType(t, http.HandlerFunc(nil), fn.Interface())
+	})
+
+	t.Run("function not found", func(t *testing.T) {
+		_, err := resolver.ResolveFunc("nonexistent.Func", reflect.TypeFor[func()]())
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "could not find function nonexistent.Func")
+	})
+
+	t.Run("mismatched type", func(t *testing.T) {
+		_, err := resolver.ResolveFunc(
+			"github.com/outriggerlabs/unsafely/typeutil_test.topLevelFunc", reflect.TypeFor[func() int](),
+		)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "expected func() int")
+	})
+}
@@ -0,0 +1,125 @@
+package unsafely
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"reflect"
+	"strings"
+	"unique"
+)
+
+func init() {
+	registerLeafCodec(encodeToAddrValue, decodeFromAddrValue)
+	genericCodecs = append(genericCodecs, uniqueHandleCodec)
+}
+
+// UniqueMaker creates unique.Handle values for a type; see WithUniqueMakers.
+type UniqueMaker struct {
+	// The type of the values in the handles.
+	t reflect.Type
+
+	// Returns the unique.Handle for the value of type t.
+	make func(v reflect.Value) reflect.Value
+}
+
+// UniqueMakerFor returns a UniqueMaker that creates unique.Handle[T] values
+// using unique.Make.
+func UniqueMakerFor[T comparable]() UniqueMaker {
+	return UniqueMaker{
+		t: reflect.TypeFor[T](),
+		make: func(v reflect.Value) reflect.Value {
+			return reflect.ValueOf(unique.Make(v.Interface().(T)))
+		},
+	}
+}
+
+// Returns a codec for unique.Handle[T], which encodes the value of the handle.
+// Handles are decoded using unique.Make, so that decoded handles are equal to
+// other handles for the same value. Since unique.Make can't be called for
+// arbitrary types, this requires a UniqueMaker for T.
+func uniqueHandleCodec(t reflect.Type) (codec, bool) {
+	if t.PkgPath() != "unique" || !strings.HasPrefix(t.Name(), "Handle[") {
+		return codec{}, false
+	}
+
+	// unique.Handle[T] has the field: value *T
+	valueField, ok := t.FieldByName("value")
+	if !ok || valueField.Type.Kind() != reflect.Pointer {
+		return codec{}, false
+	}
+
+	elemT := valueField.Type.Elem()
+
+	return codec{
+		encodedT: reflect.TypeFor[json.RawMessage](),
+		encode: func(s *JSONEncoder, inV reflect.Value) (reflect.Value, error) {
+			// The zero handle doesn't refer to a value.
+			ptrV := getField(ensureAddressable(inV).FieldByIndex(valueField.Index))
+			if ptrV.IsNil() {
+				return reflect.ValueOf(json.RawMessage("null")), nil
+			}
+
+			encodedV, err := s.encode(ptrV.Elem())
+			if err != nil {
+				return zeroValue, err
+			}
+
+			b, err := s.jsonMarshalInternal(encodedV.Interface())
+			if err != nil {
+				return zeroValue, err
+			}
+
+			return reflect.ValueOf(json.RawMessage(b)), nil
+		},
+		decode: func(s *JSONDecoder, encodedV, outV reflect.Value) error {
+			b := encodedV.Interface().(json.RawMessage)
+			if string(b) == "null" {
+				return nil
+			}
+
+			makeHandle, ok := s.config.uniqueMakers[elemT]
+			if !ok {
+				return fmt.Errorf("no UniqueMaker for %v; see WithUniqueMakers", elemT)
+			}
+
+			encodedT, err := encodedTypeFor(s.options, elemT)
+			if err != nil {
+				return err
+			}
+
+			encodedPtrV := reflect.New(encodedT)
+			if err := json.Unmarshal(b, encodedPtrV.Interface()); err != nil {
+				return err
+			}
+
+			// The value is copied when it is interned, so pointers in it can't be
+			// set later.
+			start := len(s.fixupLog)
+
+			elemV := reflect.New(elemT).Elem()
+			if err := s.decodeTo(encodedPtrV.Elem(), elemV); err != nil {
+				return err
+			}
+
+			if len(s.fixupLog) > start {
+				return fmt.Errorf("%v value refers to pointers that have not been decoded", t)
+			}
+
+			setField(outV, makeHandle(elemV))
+			return nil
+		},
+	}, true
+}
+
+// netip.Addr contains a unique.Handle for an unexported type, so addresses are
+// encoded as text instead, e.g, "192.0.2.1" or "fe80::1%eth0". The zero Addr
+// is encoded as "".
+func encodeToAddrValue(_ *JSONEncoder, in *netip.Addr) (string, error) {
+	b, err := in.MarshalText()
+	return string(b), err
+}
+
+func decodeFromAddrValue(_ *JSONDecoder, text string, out *netip.Addr) error {
+	return out.UnmarshalText([]byte(text))
+}
@@ -1,6 +1,9 @@
 package unsafely
 
 import (
+	"fmt"
+	"reflect"
+
 	"github.com/outriggerlabs/unsafely/typeutil"
 )
 
@@ -12,12 +15,38 @@ import (
 //
 // See the package notes for restrictions, limitations and options.
 func UnmarshalJSON(b []byte, outPtr any, options ...UnmarshalJSONOption) error {
-	return NewJSONDecoder(options...).Decode(b, outPtr)
+	decoder := NewJSONDecoder(options...)
+	if err := decoder.Decode(b, outPtr); err != nil {
+		return err
+	}
+
+	if unresolved := decoder.UnresolvedPointers(); len(unresolved) > 0 {
+		return fmt.Errorf("UnmarshalJSON: references to unknown pointers %q", unresolved)
+	}
+
+	return nil
 }
 
 // Configuration options for UnmarshalJSON.
 type unmarshalJSONConfig struct {
 	typeResolver typeutil.Resolver
+
+	funcResolver      typeutil.FuncResolver
+	funcPlaceholders  bool
+	closureResolution bool
+
+	placeholdersAsZero bool
+
+	lockStates bool
+
+	// Sentinel errors that are decoded by name; see WithSentinelErrorResolver.
+	sentinelErrors SentinelErrors
+
+	// Instances that are decoded by name; see WithWellKnownResolver.
+	wellKnown WellKnownInstances
+
+	// Map from types to functions that create unique.Handle values for them.
+	uniqueMakers map[reflect.Type]func(v reflect.Value) reflect.Value
 }
 
 // UnmarshalJSONOption is an option for modifying the behavior of UnmarshalJSON.
@@ -30,3 +59,79 @@ func WithTypeResolver(resolver typeutil.Resolver) UnmarshalJSONOption {
 		config.typeResolver = resolver
 	}
 }
+
+// WithFuncResolver sets the typeutil.FuncResolver used to resolve functions by
+// their symbol names.
+func WithFuncResolver(resolver typeutil.FuncResolver) UnmarshalJSONOption {
+	return func(config *unmarshalJSONConfig) {
+		config.funcResolver = resolver
+	}
+}
+
+// WithFuncPlaceholders sets functions that can't be resolved to placeholders
+// that panic when called, rather than returning an error.
+func WithFuncPlaceholders() UnmarshalJSONOption {
+	return func(config *unmarshalJSONConfig) {
+		config.funcPlaceholders = true
+	}
+}
+
+// WithClosureResolution resolves closures and method values by their symbol
+// names, like other functions. The resolved functions don't have the state
+// captured by the original functions, so by default these are not resolved.
+func WithClosureResolution() UnmarshalJSONOption {
+	return func(config *unmarshalJSONConfig) {
+		config.closureResolution = true
+	}
+}
+
+// WithPlaceholdersAsZero leaves values that were encoded as placeholders as
+// the zero value, rather than returning an error; see WithPlaceholders.
+func WithPlaceholdersAsZero() UnmarshalJSONOption {
+	return func(config *unmarshalJSONConfig) {
+		config.placeholdersAsZero = true
+	}
+}
+
+// WithLockStates restores the state of locks when unmarshaling, i.e, locked
+// sync.Mutex and sync.RWMutex values are locked, and sync.WaitGroup counters
+// are restored. By default, these are unmarshaled in their zero states.
+func WithLockStates() UnmarshalJSONOption {
+	return func(config *unmarshalJSONConfig) {
+		config.lockStates = true
+	}
+}
+
+// WithUniqueMakers sets the UniqueMakers used to unmarshal unique.Handle
+// values, so these are equal to other handles for the same values. Use
+// UniqueMakerFor to create a UniqueMaker for each type of handle.
+//
+// Unmarshaling a unique.Handle fails if there is no UniqueMaker for its type.
+// netip.Addr values don't need a UniqueMaker.
+func WithUniqueMakers(makers ...UniqueMaker) UnmarshalJSONOption {
+	return func(config *unmarshalJSONConfig) {
+		if config.uniqueMakers == nil {
+			config.uniqueMakers = make(map[reflect.Type]func(v reflect.Value) reflect.Value)
+		}
+
+		for _, maker := range makers {
+			config.uniqueMakers[maker.t] = maker.make
+		}
+	}
+}
+
+// WithSentinelErrorResolver decodes sentinel errors that were encoded by name
+// using WithSentinelErrors as the same errors.
+func WithSentinelErrorResolver(sentinels SentinelErrors) UnmarshalJSONOption {
+	return func(config *unmarshalJSONConfig) {
+		config.sentinelErrors = sentinels
+	}
+}
+
+// WithWellKnownResolver decodes references to well-known instances that were
+// encoded using WithWellKnown as the same instances.
+func WithWellKnownResolver(instances WellKnownInstances) UnmarshalJSONOption {
+	return func(config *unmarshalJSONConfig) {
+		config.wellKnown = instances
+	}
+}
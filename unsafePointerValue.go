@@ -0,0 +1,176 @@
+package unsafely
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"unsafe"
+
+	"github.com/outriggerlabs/unsafely/typeutil"
+)
+
+// The type used to represent unsafe pointers in encoded structs when using
+// WithUnsafePointers.
+var unsafePointerValueType = reflect.TypeFor[*unsafePointerValue]()
+
+// Returns true if the provided type is a *unsafePointerValue.
+func isUnsafePointerValueType(t reflect.Type) bool {
+	return t == unsafePointerValueType
+}
+
+// Represents an unsafe.Pointer as a reference to the value of another pointer.
+// If the unsafePointerValue is nil, the unsafe.Pointer was nil.
+type unsafePointerValue struct {
+	// Pointer is the ID of the pointer whose value contains the address.
+	Pointer pointerID `json:"pointer,omitempty"`
+
+	// Offset is the offset of the address in the pointer's value.
+	Offset uintptr `json:"offset,omitempty"`
+
+	// Opaque is true if the address is not in the value of any pointer.
+	Opaque bool `json:"opaque,omitempty"`
+}
+
+// Encodes the unsafe pointer to an unsafePointerValue object.
+//
+// If the unsafe pointer is nil, returns a nil *unsafePointerValue.
+func (s *JSONEncoder) encodeToUnsafePointerValue(inV reflect.Value) (reflect.Value, error) {
+	if inV.Kind() != reflect.UnsafePointer {
+		return zeroValue, fmt.Errorf(
+			"encodeToUnsafePointerValue: expected value to be an unsafe.Pointer; received %v", inV.Kind(),
+		)
+	}
+
+	addr := uintptr(inV.UnsafePointer())
+	if addr == 0 {
+		return reflect.ValueOf((*unsafePointerValue)(nil)), nil
+	}
+
+	// The referenced value needs an ID, even if it would otherwise be inlined.
+	if s.dryRun {
+		s.pointerRegions.addUnsafe(addr)
+		return reflect.ValueOf(&unsafePointerValue{Opaque: true}), nil
+	}
+
+	container, offset, ok := s.pointerRegions.findAddress(addr)
+	if !ok {
+		return reflect.ValueOf(&unsafePointerValue{Opaque: true}), nil
+	}
+
+	return reflect.ValueOf(&unsafePointerValue{
+		Pointer: s.reservePointerID(container),
+		Offset:  offset,
+	}), nil
+}
+
+// Encodes an unsafe pointer with a type hint like a pointer to the hinted
+// type.
+func (s *JSONEncoder) encodeToHintedUnsafePointer(inV, encodedV reflect.Value, hint string) error {
+	elemT, err := resolveTypeHint(s.config.unsafePointerResolver, hint)
+	if err != nil {
+		return fmt.Errorf("encodeToHintedUnsafePointer: %w", err)
+	}
+
+	if inV.Kind() != reflect.UnsafePointer {
+		return fmt.Errorf(
+			"encodeToHintedUnsafePointer: expected value to be an unsafe.Pointer; received %v", inV.Kind(),
+		)
+	}
+
+	ptrV := reflect.Zero(reflect.PointerTo(elemT))
+	if ptr := inV.UnsafePointer(); ptr != nil {
+		ptrV = reflect.NewAt(elemT, ptr)
+	}
+
+	pv, err := s.encodeToPointerValue(ptrV)
+	if err != nil {
+		return fmt.Errorf("encodeToHintedUnsafePointer: %w", err)
+	}
+
+	setField(encodedV, pv)
+	return nil
+}
+
+// Decodes the unsafePointerValue object and writes the unsafe pointer to outV.
+func (s *JSONDecoder) decodeFromUnsafePointerValue(encodedV, outV reflect.Value) error {
+	uv, ok := encodedV.Interface().(*unsafePointerValue)
+	if !ok {
+		return fmt.Errorf(
+			"decodeFromUnsafePointerValue: expected encodedV to be an *unsafePointerValue; received %T",
+			encodedV.Interface(),
+		)
+	}
+
+	if outV.Kind() != reflect.UnsafePointer {
+		return fmt.Errorf(
+			"decodeFromUnsafePointerValue: expected outV to be an unsafe.Pointer; received %v", outV.Kind(),
+		)
+	}
+
+	// Nil and opaque unsafe pointers are left nil.
+	if uv == nil || uv.Opaque || uv.Pointer == "" {
+		return nil
+	}
+
+	if ptrV, ok := s.pointerValues[uv.Pointer]; ok {
+		setUnsafePointer(outV, ptrV, uv.Offset)
+		return nil
+	}
+
+	// The referenced pointer may not have been decoded yet.
+	s.addOffsetFixup(uv.Pointer, uv.Offset, outV)
+	return nil
+}
+
+// Decodes an unsafe pointer with a type hint like a pointer to the hinted
+// type.
+func (s *JSONDecoder) decodeFromHintedUnsafePointer(encodedV, outV reflect.Value, hint string) error {
+	elemT, err := resolveTypeHint(s.config.typeResolver, hint)
+	if err != nil {
+		return fmt.Errorf("decodeFromHintedUnsafePointer: %w", err)
+	}
+
+	var (
+		ptrV  = reflect.New(reflect.PointerTo(elemT)).Elem()
+		setFn = func() { setUnsafePointer(outV, ptrV, 0) }
+	)
+
+	err = s.watchFixups(func() error { return s.decodeFromPointerValue(encodedV, ptrV) }, setFn)
+	if err != nil {
+		return fmt.Errorf("decodeFromHintedUnsafePointer: %w", err)
+	}
+
+	setFn()
+	return nil
+}
+
+// Sets the unsafe pointer in outV to the address at the offset in the value
+// referenced by ptrV.
+func setUnsafePointer(outV, ptrV reflect.Value, offset uintptr) {
+	ptr := ptrV.UnsafePointer()
+	if ptr != nil {
+		ptr = unsafe.Add(ptr, offset)
+	}
+
+	setField(outV, reflect.ValueOf(ptr).Convert(outV.Type()))
+}
+
+// Resolves the type hint of an unsafe pointer, which is a package path and type
+// name, e.g, "example.com/pkg.Node", or a type string, e.g, "[]int".
+func resolveTypeHint(resolver typeutil.Resolver, hint string) (reflect.Type, error) {
+	if resolver == nil {
+		return nil, fmt.Errorf("resolveTypeHint(): a type resolver is required to resolve type hint %q", hint)
+	}
+
+	var pkgPath, typeName string
+	if i := strings.LastIndex(hint, "."); i >= 0 && !strings.ContainsAny(hint, "[]*(){} ") {
+		pkgPath, typeName = hint[:i], hint[i+1:]
+	}
+
+	elemT, err := resolver.ResolveType(pkgPath, typeName, hint)
+	if err != nil {
+		return nil, fmt.Errorf("resolveTypeHint(): %w", err)
+	}
+
+	return elemT, nil
+}
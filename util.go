@@ -34,6 +34,49 @@ func isSimplePrimitive(kind reflect.Kind) bool {
 	}
 }
 
+// Returns the unnamed type of the simple primitive kind, e.g, int.
+func unnamedPrimitiveType(kind reflect.Kind) reflect.Type {
+	switch kind {
+	case reflect.Bool:
+		return reflect.TypeFor[bool]()
+	case reflect.Int:
+		return reflect.TypeFor[int]()
+	case reflect.Int8:
+		return reflect.TypeFor[int8]()
+	case reflect.Int16:
+		return reflect.TypeFor[int16]()
+	case reflect.Int32:
+		return reflect.TypeFor[int32]()
+	case reflect.Int64:
+		return reflect.TypeFor[int64]()
+	case reflect.Uint:
+		return reflect.TypeFor[uint]()
+	case reflect.Uint8:
+		return reflect.TypeFor[uint8]()
+	case reflect.Uint16:
+		return reflect.TypeFor[uint16]()
+	case reflect.Uint32:
+		return reflect.TypeFor[uint32]()
+	case reflect.Uint64:
+		return reflect.TypeFor[uint64]()
+	case reflect.Uintptr:
+		return reflect.TypeFor[uintptr]()
+	case reflect.Float32:
+		return reflect.TypeFor[float32]()
+	case reflect.Float64:
+		return reflect.TypeFor[float64]()
+	case reflect.String:
+		return reflect.TypeFor[string]()
+	default:
+		return nil
+	}
+}
+
+// Returns true if the kind is a float type.
+func isFloat(kind reflect.Kind) bool {
+	return kind == reflect.Float32 || kind == reflect.Float64
+}
+
 // Returns true if the kind is a complex type.
 func isComplexNumber(kind reflect.Kind) bool {
 	return kind == reflect.Complex64 || kind == reflect.Complex128
@@ -72,3 +115,11 @@ func ensureAddressable(v reflect.Value) reflect.Value {
 	vCopy.Set(v)
 	return vCopy
 }
+
+// Returns a copy of the value, which is addressable and does not change if
+// the original value changes.
+func copyValue(v reflect.Value) reflect.Value {
+	vCopy := reflect.New(v.Type()).Elem()
+	vCopy.Set(v)
+	return vCopy
+}
@@ -0,0 +1,85 @@
+package unsafely
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// WellKnownInstances is a registry of named instances, e.g, process-wide
+// singletons like http.DefaultClient or os.Stdout. Pointers, channels and
+// interface values that refer to a well-known instance are encoded as
+// {"wellKnown":"<name>"}, and decoded as the same instance.
+type WellKnownInstances struct {
+	// Map from name -> instance.
+	instances map[string]reflect.Value
+
+	// Map from instance -> name.
+	names map[any]string
+}
+
+// NewWellKnownInstances returns a new WellKnownInstances.
+func NewWellKnownInstances() WellKnownInstances {
+	return WellKnownInstances{
+		instances: make(map[string]reflect.Value),
+		names:     make(map[any]string),
+	}
+}
+
+// Add adds the instance with the given name, e.g, "net/http.DefaultClient".
+// The instance is usually a pointer, but may be any comparable value that is
+// stored in an interface.
+//
+// Panics if the instance is nil, or if it is not comparable.
+func (s WellKnownInstances) Add(name string, instance any) WellKnownInstances {
+	if instance == nil || !reflect.ValueOf(instance).Comparable() {
+		panic(fmt.Sprintf("WellKnownInstances.Add(): expected a comparable instance; received %T", instance))
+	}
+
+	s.instances[name] = reflect.ValueOf(instance)
+	s.names[instance] = name
+	return s
+}
+
+// Returns the name of the well-known instance in v, if it is one.
+func (s WellKnownInstances) nameOf(v reflect.Value) (string, bool) {
+	if len(s.names) == 0 {
+		return "", false
+	}
+
+	if v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+
+	// Values of comparable types may still hold uncomparable values in
+	// interface fields, which would panic when used as map keys.
+	if !v.IsValid() || !v.Comparable() || !v.CanInterface() {
+		return "", false
+	}
+
+	name, ok := s.names[v.Interface()]
+	return name, ok
+}
+
+// A reference to a well-known instance.
+type wellKnownValue struct {
+	WellKnown string `json:"wellKnown"`
+}
+
+// Returns true if the JSON is a reference to a well-known instance, i.e, an
+// object with only a "wellKnown" key.
+func isWellKnownJSON(b []byte) bool {
+	fields, ok := objectFields(b, func(key string) bool { return key == "wellKnown" })
+	_, hasName := fields["wellKnown"]
+	return ok && hasName
+}
+
+// Returns the well-known instance with the given name; see
+// WithWellKnownResolver.
+func (s *JSONDecoder) resolveWellKnown(name string) (reflect.Value, error) {
+	instanceV, ok := s.config.wellKnown.instances[name]
+	if !ok {
+		return zeroValue, fmt.Errorf("unknown well-known instance %s; see WithWellKnownResolver", name)
+	}
+
+	return instanceV, nil
+}